@@ -0,0 +1,444 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	// eventsBucket maps positions, drawn from its sequence, to events
+	eventsBucket = []byte("events")
+	// streamsBucket holds a bucket per aggregate mapping versions, followed
+	// by tenants, to positions
+	streamsBucket = []byte("streams")
+	// typesBucket holds a bucket per event type indexing its positions
+	typesBucket = []byte("types")
+)
+
+// BoltOption configures a BoltDriver
+type BoltOption func(*BoltDriver)
+
+// WithBoltClock sets the clock stamping saved events. Without it, events
+// created at no time are stamped by `SystemClock`.
+func WithBoltClock(clock Clock) BoltOption {
+	return func(d *BoltDriver) {
+		d.clock = clock
+	}
+}
+
+// WithBoltRegistry sets the registry decoding loaded events
+func WithBoltRegistry(registry *Registry) BoltOption {
+	return func(d *BoltDriver) {
+		d.registry = registry
+	}
+}
+
+// WithBoltTenancy requires a tenant on every load, save and read
+func WithBoltTenancy() BoltOption {
+	return func(d *BoltDriver) {
+		d.multiTenant = true
+	}
+}
+
+// NewBoltDriver creates a BoltDriver on the given database, creating the
+// buckets it needs when missing
+func NewBoltDriver(db *bbolt.DB, options ...BoltOption) (*BoltDriver, error) {
+	d := &BoltDriver{DB: db}
+	for _, option := range options {
+		option(d)
+	}
+
+	err := db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{eventsBucket, streamsBucket, typesBucket} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// BoltDriver implements an embedded event-store on top of bbolt. Events are
+// kept by position, while per-aggregate streams and per-type indexes make
+// loads and reads seeks rather than scans. Every save is a single ACID
+// transaction.
+type BoltDriver struct {
+	DB          *bbolt.DB
+	clock       Clock
+	registry    *Registry
+	multiTenant bool
+}
+
+// Load loads all events by aggregate ID ordered by version
+func (d *BoltDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext loads all events by aggregate ID ordered by version, scoped to
+// the context tenant
+func (d *BoltDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	return d.loadFrom(ctx, aggregateID, nil)
+}
+
+// LatestVersion returns the version of the latest event for the given
+// aggregateID, or zero when there are none, scoped to the context tenant
+func (d *BoltDriver) LatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	err = d.DB.View(func(tx *bbolt.Tx) error {
+		stream := tx.Bucket(streamsBucket).Bucket([]byte(aggregateID))
+		if stream == nil {
+			return nil
+		}
+
+		events := tx.Bucket(eventsBucket)
+		cursor := stream.Cursor()
+		for k, position := cursor.Last(); k != nil; k, position = cursor.Prev() {
+			record, err := readStoredEvent(events, position)
+			if err != nil {
+				return err
+			}
+			if record.TenantID == tenantID {
+				version = record.AggregateVersion
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// LoadAfter loads the events for the given aggregateID with a version greater
+// than the given one, ordered by version and scoped to the context tenant
+func (d *BoltDriver) LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*Event, error) {
+	return d.loadFrom(ctx, aggregateID, versionKey(version+1))
+}
+
+// loadFrom loads the stream of the given aggregateID from the given version
+// key onwards, or from its start when nil
+func (d *BoltDriver) loadFrom(ctx context.Context, aggregateID string, start []byte) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := contextRegistry(ctx, d.registry)
+	var events []*Event
+	err = d.DB.View(func(tx *bbolt.Tx) error {
+		stream := tx.Bucket(streamsBucket).Bucket([]byte(aggregateID))
+		if stream == nil {
+			return nil
+		}
+
+		cursor := stream.Cursor()
+		k, position := cursor.First()
+		if start != nil {
+			k, position = cursor.Seek(start)
+		}
+		for ; k != nil; k, position = cursor.Next() {
+			event, err := d.readEvent(tx, position, tenantID, registry)
+			if err != nil {
+				return err
+			}
+			if event != nil {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Save saves all given events in a single transaction, assigning their
+// positions. If any of the events violates optimistic locking, none of them
+// is saved. Versions are unique per tenant and aggregate.
+func (d *BoltDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext saves all given events like `Save`, stamping them with the
+// context tenant
+func (d *BoltDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := stampTenant(ctx, events, d.multiTenant)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	clock := contextClock(ctx, d.clock)
+	created := make([]time.Time, len(events))
+	positions := make([]uint64, len(events))
+	err = d.DB.Update(func(tx *bbolt.Tx) error {
+		byPosition := tx.Bucket(eventsBucket)
+		streams := tx.Bucket(streamsBucket)
+		types := tx.Bucket(typesBucket)
+
+		for i, event := range events {
+			stream, err := streams.CreateBucketIfNotExists([]byte(event.AggregateID))
+			if err != nil {
+				return err
+			}
+			version := streamKey(event.AggregateVersion, event.TenantID)
+			if stream.Get(version) != nil {
+				return ErrOptimisticLocking
+			}
+
+			payload, err := event.marshalPayload()
+			if err != nil {
+				return err
+			}
+			position, err := byPosition.NextSequence()
+			if err != nil {
+				return err
+			}
+			created[i] = createdAt(event, clock, SystemClock)
+			record, err := json.Marshal(&storedEvent{
+				ID:               int64(position),
+				EventID:          event.ID,
+				TenantID:         event.TenantID,
+				Type:             event.Type,
+				AggregateID:      event.AggregateID,
+				AggregateType:    event.AggregateType,
+				AggregateVersion: event.AggregateVersion,
+				Created:          created[i],
+				Payload:          payload,
+			})
+			if err != nil {
+				return err
+			}
+
+			key := positionKey(position)
+			err = byPosition.Put(key, record)
+			if err != nil {
+				return err
+			}
+			err = stream.Put(version, key)
+			if err != nil {
+				return err
+			}
+			index, err := types.CreateBucketIfNotExists([]byte(event.Type))
+			if err != nil {
+				return err
+			}
+			err = index.Put(key, nil)
+			if err != nil {
+				return err
+			}
+			positions[i] = position
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, event := range events {
+		event.Position = int64(positions[i])
+		event.Created = created[i]
+	}
+	return nil
+}
+
+// RemoveStream deletes all events for the given aggregateID, scoped to the
+// context tenant. Their positions are never reused.
+func (d *BoltDriver) RemoveStream(ctx context.Context, aggregateID string) error {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	return d.DB.Update(func(tx *bbolt.Tx) error {
+		streams := tx.Bucket(streamsBucket)
+		stream := streams.Bucket([]byte(aggregateID))
+		if stream == nil {
+			return nil
+		}
+
+		events := tx.Bucket(eventsBucket)
+		types := tx.Bucket(typesBucket)
+		var removed [][]byte
+		err := stream.ForEach(func(version, position []byte) error {
+			record, err := readStoredEvent(events, position)
+			if err != nil {
+				return err
+			}
+			if record.TenantID != tenantID {
+				return nil
+			}
+
+			err = events.Delete(position)
+			if err != nil {
+				return err
+			}
+			if index := types.Bucket([]byte(record.Type)); index != nil {
+				err = index.Delete(position)
+				if err != nil {
+					return err
+				}
+			}
+			removed = append(removed, version)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Keys can't be deleted while iterating the bucket holding them
+		for _, version := range removed {
+			err = stream.Delete(version)
+			if err != nil {
+				return err
+			}
+		}
+		if k, _ := stream.Cursor().First(); k == nil {
+			return streams.DeleteBucket([]byte(aggregateID))
+		}
+		return nil
+	})
+}
+
+// ReadEventsOfTypes reads events of the given types after the given position
+func (d *BoltDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext reads events of the given types after the given
+// position, scoped to the context tenant. The type indexes are merged by
+// position, so only matching events are ever read.
+func (d *BoltDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := contextRegistry(ctx, d.registry)
+	var events []*Event
+	err = d.DB.View(func(tx *bbolt.Tx) error {
+		indexes := tx.Bucket(typesBucket)
+		start := positionKey(uint64(position) + 1)
+		if position < 0 {
+			start = positionKey(0)
+		}
+
+		var cursors []*bbolt.Cursor
+		var heads [][]byte
+		seen := map[string]bool{}
+		for _, t := range types {
+			index := indexes.Bucket([]byte(t))
+			if index == nil || seen[t] {
+				continue
+			}
+			seen[t] = true
+			cursor := index.Cursor()
+			if k, _ := cursor.Seek(start); k != nil {
+				cursors = append(cursors, cursor)
+				heads = append(heads, k)
+			}
+		}
+
+		for uint(len(events)) < count && len(cursors) > 0 {
+			next := 0
+			for i := range heads {
+				if bytes.Compare(heads[i], heads[next]) < 0 {
+					next = i
+				}
+			}
+
+			event, err := d.readEvent(tx, heads[next], tenantID, registry)
+			if err != nil {
+				return err
+			}
+			if event != nil {
+				events = append(events, event)
+			}
+
+			if k, _ := cursors[next].Next(); k != nil {
+				heads[next] = k
+			} else {
+				cursors = append(cursors[:next], cursors[next+1:]...)
+				heads = append(heads[:next], heads[next+1:]...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// readEvent decodes the event at the given position with the given registry,
+// or returns nil when it belongs to another tenant than the given one or its
+// type is unknown and skipped
+func (d *BoltDriver) readEvent(tx *bbolt.Tx, position []byte, tenantID string, registry *Registry) (*Event, error) {
+	record, err := readStoredEvent(tx.Bucket(eventsBucket), position)
+	if err != nil {
+		return nil, err
+	}
+	if record.TenantID != tenantID {
+		return nil, nil
+	}
+
+	return record.toEvent(registry)
+}
+
+func readStoredEvent(events *bbolt.Bucket, position []byte) (*storedEvent, error) {
+	data := events.Get(position)
+	if data == nil {
+		return nil, fmt.Errorf("missing event at position %d", binary.BigEndian.Uint64(position))
+	}
+
+	var record storedEvent
+	err := json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// positionKey encodes positions so that keys sort in position order
+func positionKey(position uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, position)
+	return key
+}
+
+// versionKey encodes versions so that keys sort in version order, negative
+// ones included
+func versionKey(version int64) []byte {
+	return positionKey(uint64(version) ^ 1<<63)
+}
+
+// streamKey encodes the version of an event followed by its tenant, for
+// tenants not to take versions of each other's streams
+func streamKey(version int64, tenantID string) []byte {
+	return append(versionKey(version), tenantID...)
+}
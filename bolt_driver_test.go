@@ -0,0 +1,217 @@
+package es_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.etcd.io/bbolt"
+)
+
+type BoltDriverSuite struct {
+	suite.Suite
+	dir    string
+	db     *bbolt.DB
+	driver *es.BoltDriver
+}
+
+func TestBoltDriverSuite(t *testing.T) {
+	suite.Run(t, new(BoltDriverSuite))
+}
+
+func (s *BoltDriverSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "bolt")
+	s.NoError(err)
+	s.dir = dir
+	s.db = s.open()
+	s.driver, err = es.NewBoltDriver(s.db)
+	s.NoError(err)
+}
+
+func (s *BoltDriverSuite) TearDownTest() {
+	err := s.db.Close()
+	s.NoError(err)
+	err = os.RemoveAll(s.dir)
+	s.NoError(err)
+}
+
+func (s *BoltDriverSuite) TestSaveAndLoad() {
+	events := []*es.Event{
+		s.event("AggregateID#1", 1, "AggregateID#1 - V1"),
+		s.event("AggregateID#2", 1, "AggregateID#2 - V1"),
+		s.event("AggregateID#1", 2, "AggregateID#1 - V2"),
+	}
+	err := s.driver.Save(events)
+	s.NoError(err)
+	s.Equal(int64(3), events[2].Position)
+
+	loaded, err := s.driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal([]*es.Event{events[0], events[2]}, loaded)
+	s.WithinDuration(time.Now(), loaded[1].Created, time.Minute)
+
+	version, err := s.driver.LatestVersion(context.Background(), "AggregateID#1")
+	s.NoError(err)
+	s.Equal(int64(2), version)
+
+	loaded, err = s.driver.LoadAfter(context.Background(), "AggregateID#1", 1)
+	s.NoError(err)
+	s.Equal([]*es.Event{events[2]}, loaded)
+
+	loaded, err = s.driver.Load("AggregateID#3")
+	s.NoError(err)
+	s.Empty(loaded)
+}
+
+func (s *BoltDriverSuite) TestPersistsAcrossReopen() {
+	err := s.driver.Save([]*es.Event{s.event("AggregateID#1", 1, "1")})
+	s.NoError(err)
+	err = s.db.Close()
+	s.NoError(err)
+
+	s.db = s.open()
+	driver, err := es.NewBoltDriver(s.db)
+	s.NoError(err)
+	err = driver.Save([]*es.Event{s.event("AggregateID#1", 2, "2")})
+	s.NoError(err)
+
+	events, err := driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(&SomethingHappened{Data: "1"}, events[0].Payload)
+	s.Equal(int64(2), events[1].Position, "Positions carry on after reopening")
+}
+
+func (s *BoltDriverSuite) TestSaveOptimisticLocking() {
+	err := s.driver.Save([]*es.Event{s.event("AggregateID#1", 1, "")})
+	s.NoError(err)
+
+	err = s.driver.Save([]*es.Event{s.event("AggregateID#2", 1, ""), s.event("AggregateID#1", 1, "")})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+	err = s.driver.Save([]*es.Event{s.event("AggregateID#2", 1, ""), s.event("AggregateID#2", 1, "")})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+
+	events, err := s.driver.Load("AggregateID#2")
+	s.NoError(err)
+	s.Empty(events, "Nothing saved on violation")
+
+	err = s.driver.Save([]*es.Event{s.event("AggregateID#2", 1, "")})
+	s.NoError(err)
+	events, err = s.driver.Load("AggregateID#2")
+	s.NoError(err)
+	s.Equal(int64(2), events[0].Position, "Positions of rolled back saves are not taken")
+}
+
+func (s *BoltDriverSuite) TestReadEventsForward() {
+	err := s.driver.Save([]*es.Event{
+		es.NewEvent("AggregateID#1", &SomethingHappened{Data: "1"}),
+		es.NewEvent("AggregateID#2", &SomethingElseHappened{Data: "2"}),
+		es.NewEvent("AggregateID#3", &SomethingHappened{Data: "3"}),
+		es.NewEvent("AggregateID#4", &SomethingElseHappened{Data: "4"}),
+	})
+	s.NoError(err)
+
+	events, err := s.driver.ReadEventsOfTypes(0, 3, []string{"SomethingHappened", "SomethingElseHappened"})
+	s.NoError(err)
+	s.Equal(3, len(events))
+	s.Equal(int64(1), events[0].Position)
+	s.Equal(int64(2), events[1].Position)
+	s.Equal(int64(3), events[2].Position)
+
+	events, err = s.driver.ReadEventsOfTypes(1, 10, []string{"SomethingHappened", "SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "3"}, events[0].Payload)
+
+	events, err = s.driver.ReadEventsOfTypes(3, 10, []string{"SomethingHappened", "UnknownType"})
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *BoltDriverSuite) TestRemoveStream() {
+	err := s.driver.Save([]*es.Event{
+		s.event("AggregateID#1", 1, "1"),
+		s.event("AggregateID#2", 1, "2"),
+		s.event("AggregateID#1", 2, "3"),
+	})
+	s.NoError(err)
+
+	err = s.driver.RemoveStream(context.Background(), "AggregateID#1")
+	s.NoError(err)
+
+	events, err := s.driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Empty(events)
+	events, err = s.driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(int64(2), events[0].Position)
+
+	err = s.driver.Save([]*es.Event{s.event("AggregateID#1", 1, "4")})
+	s.NoError(err)
+	events, err = s.driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal(int64(4), events[0].Position, "Positions are never reused")
+}
+
+func (s *BoltDriverSuite) TestTenantIsolation() {
+	driver, err := es.NewBoltDriver(s.db, es.WithBoltTenancy())
+	s.NoError(err)
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+
+	err = driver.SaveContext(acme, []*es.Event{s.event("AggregateID#1", 1, "acme")})
+	s.NoError(err)
+
+	events, err := driver.LoadContext(acme, "AggregateID#1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("acme", events[0].TenantID)
+	events, err = driver.LoadContext(globex, "AggregateID#1")
+	s.NoError(err)
+	s.Empty(events)
+	version, err := driver.LatestVersion(globex, "AggregateID#1")
+	s.NoError(err)
+	s.Equal(int64(0), version)
+	events, err = driver.ReadEventsOfTypesContext(globex, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events)
+
+	_, err = driver.Load("AggregateID#1")
+	s.Equal(es.ErrTenantRequired, err)
+}
+
+func (s *BoltDriverSuite) open() *bbolt.DB {
+	db, err := bbolt.Open(filepath.Join(s.dir, "events.db"), 0600, &bbolt.Options{Timeout: time.Second})
+	s.Require().NoError(err)
+	return db
+}
+
+func (s *BoltDriverSuite) event(aggregateID string, version int64, data string) *es.Event {
+	event := es.NewEvent(aggregateID, &SomethingHappened{Data: data})
+	event.AggregateVersion = version
+	return event
+}
+
+func TestBoltDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		dir, err := ioutil.TempDir("", "bolt")
+		require.NoError(t, err)
+		db, err := bbolt.Open(filepath.Join(dir, "events.db"), 0600, nil)
+		require.NoError(t, err)
+		driver, err := es.NewBoltDriver(db)
+		require.NoError(t, err)
+		return driver, func() {
+			es.ShouldClose(db)
+			_ = os.RemoveAll(dir)
+		}
+	})
+}
@@ -0,0 +1,203 @@
+package es
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// CachingOption configures a CachingDriver
+type CachingOption func(*CachingDriver)
+
+// WithCacheLimits bounds how many aggregates and how many events in total
+// are kept in the cache. Least recently used aggregates are evicted first.
+// Defaults to 1000 aggregates and 100000 events.
+func WithCacheLimits(aggregates int, events int) CachingOption {
+	return func(d *CachingDriver) {
+		d.maxAggregates = aggregates
+		d.maxEvents = events
+	}
+}
+
+// NewCachingDriver creates a new CachingDriver
+func NewCachingDriver(driver VersionedDriver, options ...CachingOption) *CachingDriver {
+	d := &CachingDriver{
+		Driver:        driver,
+		maxAggregates: 1000,
+		maxEvents:     100000,
+		entries:       map[string]*list.Element{},
+		recency:       list.New(),
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// CachingDriver implementation keeping the decoded event streams of recently
+// loaded aggregates in memory. A cached stream is validated against the
+// latest version known by the internal driver on every `Load`, and caught up
+// by loading only the events it misses. Every load gets its own copies of the
+// cached events, decoding lazily loaded payloads on its own, while decoded
+// payloads are shared between loads and must not be mutated.
+type CachingDriver struct {
+	Driver        VersionedDriver
+	maxAggregates int
+	maxEvents     int
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	recency *list.List
+	events  int
+}
+
+type cacheEntry struct {
+	key    string
+	events []*Event
+}
+
+// Load loads events from the cache, catching up with the internal driver
+func (d *CachingDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`. Streams are cached per tenant.
+func (d *CachingDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	key := cacheKey(TenantFromContext(ctx), aggregateID)
+	cached := d.get(key)
+	if cached == nil {
+		return d.load(ctx, key, aggregateID)
+	}
+
+	version := cached[len(cached)-1].AggregateVersion
+	latest, err := d.Driver.LatestVersion(ctx, aggregateID)
+	if err != nil {
+		return nil, err
+	}
+	if latest == version {
+		return cached, nil
+	}
+	if latest < version {
+		return d.load(ctx, key, aggregateID)
+	}
+
+	newEvents, err := d.Driver.LoadAfter(ctx, aggregateID, version)
+	if err != nil {
+		return nil, err
+	}
+	events := append(cached, newEvents...)
+	d.put(key, events)
+	return events, nil
+}
+
+// Save delegates to internal driver, invalidating cached aggregates
+func (d *CachingDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (d *CachingDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := saveContext(ctx, d.Driver, events)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		d.invalidate(cacheKey(event.TenantID, event.AggregateID))
+	}
+	return nil
+}
+
+// ReadEventsOfTypes delegates to internal driver
+func (d *CachingDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *CachingDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	return readEventsOfTypesContext(ctx, d.Driver, position, count, types)
+}
+
+func (d *CachingDriver) load(ctx context.Context, key string, aggregateID string) ([]*Event, error) {
+	events, err := loadContext(ctx, d.Driver, aggregateID)
+	if err != nil {
+		d.invalidate(key)
+		return nil, err
+	}
+
+	d.put(key, events)
+	return events, nil
+}
+
+// cacheKey keeps the streams of different tenants apart
+func cacheKey(tenantID string, aggregateID string) string {
+	return tenantID + "/" + aggregateID
+}
+
+// get returns copies of the cached events, marking them as recently used
+func (d *CachingDriver) get(key string) []*Event {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	element, ok := d.entries[key]
+	if !ok {
+		return nil
+	}
+	d.recency.MoveToFront(element)
+
+	return copyEvents(element.Value.(*cacheEntry).events)
+}
+
+// put caches copies of the given events, evicting least recently used
+// streams to stay within limits. Empty streams and streams not fitting the
+// cache on their own are not cached.
+func (d *CachingDriver) put(key string, events []*Event) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.remove(key)
+	if len(events) == 0 || len(events) > d.maxEvents || d.maxAggregates <= 0 {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:    key,
+		events: copyEvents(events),
+	}
+	d.entries[key] = d.recency.PushFront(entry)
+	d.events += len(events)
+
+	for len(d.entries) > d.maxAggregates || d.events > d.maxEvents {
+		oldest := d.recency.Back().Value.(*cacheEntry)
+		d.remove(oldest.key)
+	}
+}
+
+func (d *CachingDriver) invalidate(key string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.remove(key)
+}
+
+func (d *CachingDriver) remove(key string) {
+	element, ok := d.entries[key]
+	if !ok {
+		return
+	}
+
+	d.recency.Remove(element)
+	delete(d.entries, key)
+	d.events -= len(element.Value.(*cacheEntry).events)
+}
+
+// copyEvents copies the given events, so that decoding the payloads of the
+// copies never races with other loads
+func copyEvents(events []*Event) []*Event {
+	copies := make([]*Event, len(events))
+	for i, event := range events {
+		copied := *event
+		copies[i] = &copied
+	}
+	return copies
+}
@@ -0,0 +1,282 @@
+package es_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/suite"
+)
+
+type CachingDriverSuite struct {
+	suite.Suite
+}
+
+func TestCachingDriverSuite(t *testing.T) {
+	suite.Run(t, new(CachingDriverSuite))
+}
+
+func (s *CachingDriverSuite) TestServesUpToDateStreamsFromCache() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver()}
+	cachingDriver := es.NewCachingDriver(driver)
+	err := cachingDriver.Save(s.events("1", 1, 2))
+	s.NoError(err)
+
+	events, err := cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(2, len(events))
+	events, err = cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(&SomethingHappened{Data: "2"}, events[1].Payload)
+
+	s.Equal(1, driver.Loads)
+	s.Equal(1, driver.LatestVersions)
+	s.Equal(0, driver.LoadsAfter)
+}
+
+func (s *CachingDriverSuite) TestCatchesUpWithNewEvents() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver()}
+	cachingDriver := es.NewCachingDriver(driver)
+	err := cachingDriver.Save(s.events("1", 1, 2))
+	s.NoError(err)
+	_, err = cachingDriver.Load("1")
+	s.NoError(err)
+
+	err = driver.Save(s.events("1", 3, 4))
+	s.NoError(err)
+
+	events, err := cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(4, len(events))
+	for i, event := range events {
+		s.Equal(int64(i+1), event.AggregateVersion)
+	}
+	s.Equal(1, driver.Loads)
+	s.Equal(1, driver.LoadsAfter)
+
+	events, err = cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(4, len(events))
+	s.Equal(1, driver.Loads)
+	s.Equal(1, driver.LoadsAfter)
+}
+
+func (s *CachingDriverSuite) TestInvalidatesOnSave() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver()}
+	cachingDriver := es.NewCachingDriver(driver)
+	err := cachingDriver.Save(s.events("1", 1))
+	s.NoError(err)
+	_, err = cachingDriver.Load("1")
+	s.NoError(err)
+
+	err = cachingDriver.Save(s.events("1", 2))
+	s.NoError(err)
+
+	events, err := cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(2, driver.Loads)
+	s.Equal(0, driver.LatestVersions)
+}
+
+func (s *CachingDriverSuite) TestKeepsCacheWhenSaveFails() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver()}
+	cachingDriver := es.NewCachingDriver(driver)
+	err := cachingDriver.Save(s.events("1", 1))
+	s.NoError(err)
+	_, err = cachingDriver.Load("1")
+	s.NoError(err)
+
+	err = cachingDriver.Save(s.events("1", 1))
+	s.Error(err)
+
+	_, err = cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(1, driver.Loads)
+}
+
+func (s *CachingDriverSuite) TestEvictsLeastRecentlyUsedAggregates() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver()}
+	cachingDriver := es.NewCachingDriver(driver, es.WithCacheLimits(2, 100))
+	for _, id := range []string{"1", "2", "3"} {
+		err := cachingDriver.Save(s.events(id, 1))
+		s.NoError(err)
+	}
+
+	for _, id := range []string{"1", "2", "1", "3"} {
+		_, err := cachingDriver.Load(id)
+		s.NoError(err)
+	}
+	s.Equal(3, driver.Loads)
+
+	_, err := cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(3, driver.Loads, "1 was recently used")
+
+	_, err = cachingDriver.Load("2")
+	s.NoError(err)
+	s.Equal(4, driver.Loads, "2 was evicted")
+}
+
+func (s *CachingDriverSuite) TestEvictsToStayWithinEventsLimit() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver()}
+	cachingDriver := es.NewCachingDriver(driver, es.WithCacheLimits(10, 3))
+	err := cachingDriver.Save(append(s.events("1", 1, 2), s.events("2", 1, 2)...))
+	s.NoError(err)
+	err = cachingDriver.Save(s.events("3", 1, 2, 3, 4))
+	s.NoError(err)
+
+	_, err = cachingDriver.Load("1")
+	s.NoError(err)
+	_, err = cachingDriver.Load("2")
+	s.NoError(err)
+	_, err = cachingDriver.Load("2")
+	s.NoError(err)
+	s.Equal(2, driver.Loads, "2 is cached")
+
+	_, err = cachingDriver.Load("1")
+	s.NoError(err)
+	s.Equal(3, driver.Loads, "1 was evicted to fit 2")
+
+	_, err = cachingDriver.Load("3")
+	s.NoError(err)
+	_, err = cachingDriver.Load("3")
+	s.NoError(err)
+	s.Equal(5, driver.Loads, "3 does not fit the cache")
+}
+
+func (s *CachingDriverSuite) TestReturnedStreamsDoNotAlterCache() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver()}
+	cachingDriver := es.NewCachingDriver(driver)
+	err := cachingDriver.Save(s.events("1", 1, 2))
+	s.NoError(err)
+
+	events, err := cachingDriver.Load("1")
+	s.NoError(err)
+	events[0] = nil
+
+	events, err = cachingDriver.Load("1")
+	s.NoError(err)
+	s.NotNil(events[0])
+}
+
+func (s *CachingDriverSuite) TestDecodesLazilyLoadedEventsConcurrently() {
+	registry := es.NewRegistry()
+	s.NoError(registry.Register(SomethingHappened{}))
+	registry.SetLazyDecoding(true)
+	cachingDriver := es.NewCachingDriver(es.NewInMemoryDriver(es.WithInMemoryRegistry(registry)))
+	err := cachingDriver.Save(s.events("1", 1, 2))
+	s.NoError(err)
+	_, err = cachingDriver.Load("1")
+	s.NoError(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			events, err := cachingDriver.Load("1")
+			s.NoError(err)
+			for _, event := range events {
+				_, err = event.DecodePayload()
+				s.NoError(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	events, err := cachingDriver.Load("1")
+	s.NoError(err)
+	s.Nil(events[1].Payload, "Cached events are decoded by each load on its own")
+	payload, err := events[1].DecodePayload()
+	s.NoError(err)
+	s.Equal(&SomethingHappened{Data: "2"}, payload)
+}
+
+func (s *CachingDriverSuite) TestCachesStreamsPerTenant() {
+	driver := &CountingDriver{InMemoryDriver: es.NewInMemoryDriver(es.WithInMemoryTenancy())}
+	cachingDriver := es.NewCachingDriver(driver)
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+	err := cachingDriver.SaveContext(acme, s.events("1", 1, 2))
+	s.NoError(err)
+
+	events, err := cachingDriver.LoadContext(acme, "1")
+	s.NoError(err)
+	s.Equal(2, len(events))
+	events, err = cachingDriver.LoadContext(globex, "1")
+	s.NoError(err)
+	s.Empty(events, "Stream cached for another tenant")
+	_, err = cachingDriver.Load("1")
+	s.Equal(es.ErrTenantRequired, err)
+	s.Equal(3, driver.Loads)
+}
+
+func (s *CachingDriverSuite) TestWorksWithStore() {
+	store := es.NewStore(es.NewCachingDriver(es.NewInMemoryDriver()))
+
+	sampleAggregate := &SampleAggregate{}
+	err := store.Save(sampleAggregate.DoSomething("1", []string{"event-1", "event-2"}))
+	s.NoError(err)
+
+	first := &SampleAggregate{}
+	err = store.Load("1", first)
+	s.NoError(err)
+	second := &SampleAggregate{}
+	err = store.Load("1", second)
+	s.NoError(err)
+	s.Equal([]string{"event-1", "event-2"}, second.ReducedData)
+
+	err = store.Save(first.DoSomething("1", []string{"event-3"}))
+	s.NoError(err)
+	err = store.Save(second.DoSomething("1", []string{"event-3"}))
+	s.Error(err, "Cached version is stamped on the aggregate")
+
+	reloaded := &SampleAggregate{}
+	err = store.Load("1", reloaded)
+	s.NoError(err)
+	s.Equal([]string{"event-1", "event-2", "event-3"}, reloaded.ReducedData)
+}
+
+func (s *CachingDriverSuite) events(aggregateID string, versions ...int64) []*es.Event {
+	events := []*es.Event{}
+	for _, version := range versions {
+		event := es.NewEvent(aggregateID, &SomethingHappened{Data: strconv.FormatInt(version, 10)})
+		event.AggregateVersion = version
+		events = append(events, event)
+	}
+	return events
+}
+
+// CountingDriver counts calls reaching the in-memory driver
+type CountingDriver struct {
+	*es.InMemoryDriver
+	Loads          int
+	LatestVersions int
+	LoadsAfter     int
+}
+
+func (d *CountingDriver) LoadContext(ctx context.Context, aggregateID string) ([]*es.Event, error) {
+	d.Loads++
+	return d.InMemoryDriver.LoadContext(ctx, aggregateID)
+}
+
+func (d *CountingDriver) LatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	d.LatestVersions++
+	return d.InMemoryDriver.LatestVersion(ctx, aggregateID)
+}
+
+func (d *CountingDriver) LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*es.Event, error) {
+	d.LoadsAfter++
+	return d.InMemoryDriver.LoadAfter(ctx, aggregateID, version)
+}
+
+func TestCachingDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		return es.NewCachingDriver(es.NewInMemoryDriver()), nil
+	})
+}
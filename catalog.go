@@ -0,0 +1,317 @@
+package es
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// asyncAPIVersion is the AsyncAPI specification version of generated
+// documents
+const asyncAPIVersion = "2.6.0"
+
+// PayloadInfo describes a registered payload
+type PayloadInfo struct {
+	Type          string
+	AggregateType string
+	Version       int
+	GoType        string
+	Fields        []FieldInfo
+	Schema        *Schema
+}
+
+// FieldInfo describes a property of an encoded payload
+type FieldInfo struct {
+	Name     string
+	GoType   string
+	Type     string
+	Required bool
+}
+
+// Payloads describes every registered payload, ordered by type
+func (r *Registry) Payloads() []PayloadInfo {
+	var payloads []PayloadInfo
+	for name, schema := range r.Schemas() {
+		payloads = append(payloads, PayloadInfo{
+			Type:          name,
+			AggregateType: schema.AggregateType,
+			Version:       schema.Version,
+			GoType:        schema.goType,
+			Fields:        schemaFields(schema, name),
+			Schema:        schema,
+		})
+	}
+
+	sort.Slice(payloads, func(i, j int) bool {
+		return payloads[i].Type < payloads[j].Type
+	})
+	return payloads
+}
+
+// PayloadsByAggregate describes every registered payload, grouped by the
+// type of aggregate emitting them and ordered by type
+func (r *Registry) PayloadsByAggregate() map[string][]PayloadInfo {
+	aggregates := map[string][]PayloadInfo{}
+	for _, payload := range r.Payloads() {
+		aggregates[payload.AggregateType] = append(aggregates[payload.AggregateType], payload)
+	}
+	return aggregates
+}
+
+// schemaFields describes the properties of the given object schema in
+// declaration order, the root schema being named as given
+func schemaFields(schema *Schema, rootName string) []FieldInfo {
+	var fields []FieldInfo
+	for _, name := range schema.order {
+		property := schema.Properties[name]
+		fields = append(fields, FieldInfo{
+			Name:     name,
+			GoType:   property.goType,
+			Type:     describeSchema(property, rootName),
+			Required: contains(schema.Required, name),
+		})
+	}
+	return fields
+}
+
+// describeSchema names what the given schema allows in a few words, like
+// "array of string or null"
+func describeSchema(schema *Schema, rootName string) string {
+	switch {
+	case schema.Ref == "#":
+		return rootName
+	case schema.Ref != "":
+		return defName(schema.Ref)
+	case len(schema.AnyOf) > 0:
+		var options []string
+		for _, option := range schema.AnyOf {
+			options = append(options, describeSchema(option, rootName))
+		}
+		return strings.Join(options, " or ")
+	case len(schema.Type) == 0:
+		return "any"
+	}
+
+	var types []string
+	for _, t := range schema.Type {
+		switch {
+		case t == "array" && schema.Items != nil:
+			t = "array of " + describeSchema(schema.Items, rootName)
+		case t == "object" && schema.Properties == nil:
+			if additional, ok := schema.AdditionalProperties.(*Schema); ok {
+				t = "map of " + describeSchema(additional, rootName)
+			}
+		case t == "string" && schema.Format != "":
+			t = fmt.Sprintf("string (%s)", schema.Format)
+		case t == "string" && schema.ContentEncoding != "":
+			t = fmt.Sprintf("string (%s)", schema.ContentEncoding)
+		}
+		types = append(types, t)
+	}
+	return strings.Join(types, " or ")
+}
+
+// defName returns the name of the definition the given reference points to
+func defName(ref string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(strings.TrimPrefix(ref, "#/$defs/"))
+}
+
+// WriteCatalog writes a Markdown catalog of every registered payload, by
+// aggregate type, listing their fields and those of the structs they hold
+func (r *Registry) WriteCatalog(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# Event catalog\n")
+
+	aggregates := r.PayloadsByAggregate()
+	var aggregateTypes []string
+	for aggregateType := range aggregates {
+		aggregateTypes = append(aggregateTypes, aggregateType)
+	}
+	sort.Strings(aggregateTypes)
+
+	for _, aggregateType := range aggregateTypes {
+		fmt.Fprintf(&b, "\n## %s\n", aggregateType)
+		for _, payload := range aggregates[aggregateType] {
+			fmt.Fprintf(&b, "\n### %s\n\n", payload.Type)
+			if payload.Version != 0 {
+				fmt.Fprintf(&b, "Version %d, encoded from `%s`.\n", payload.Version, payload.GoType)
+			} else {
+				fmt.Fprintf(&b, "Encoded from `%s`.\n", payload.GoType)
+			}
+			writeFieldsTable(&b, payload.Fields)
+
+			var defs []string
+			for name := range payload.Schema.Defs {
+				defs = append(defs, name)
+			}
+			sort.Strings(defs)
+			for _, name := range defs {
+				fmt.Fprintf(&b, "\n#### %s\n", name)
+				writeFieldsTable(&b, schemaFields(payload.Schema.Defs[name], payload.Type))
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFieldsTable(b *strings.Builder, fields []FieldInfo) {
+	if len(fields) == 0 {
+		b.WriteString("\nNo fields.\n")
+		return
+	}
+
+	b.WriteString("\n| Field | Type | Required | Go type |\n|---|---|---|---|\n")
+	for _, field := range fields {
+		required := "no"
+		if field.Required {
+			required = "yes"
+		}
+		fmt.Fprintf(b, "| `%s` | %s | %s | `%s` |\n", field.Name, field.Type, required, field.GoType)
+	}
+}
+
+// AsyncAPIInfo describes the application publishing saved events through an
+// `SNSDriver`
+type AsyncAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+	TopicArn    string
+}
+
+// AsyncAPI generates an AsyncAPI document describing the notifications the
+// `SNSDriver` publishes to the given topic: the IDs of saved events by type,
+// with their types and trace context as message attributes. The schemas of
+// registered payloads are included as components, for consumers reading the
+// events.
+func (r *Registry) AsyncAPI(info AsyncAPIInfo) ([]byte, error) {
+	payloads := r.Payloads()
+	types := []string{}
+	properties := map[string]interface{}{}
+	schemas := map[string]interface{}{}
+	for _, payload := range payloads {
+		types = append(types, payload.Type)
+		properties[payload.Type] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]string{"type": "string"},
+			"description": fmt.Sprintf("IDs of the saved %s events of %s aggregates", payload.Type, payload.AggregateType),
+		}
+		schemas[payload.Type] = payload.Schema.rebased("#/components/schemas/" + payload.Type)
+	}
+
+	documentInfo := map[string]string{
+		"title":   info.Title,
+		"version": info.Version,
+	}
+	if info.Description != "" {
+		documentInfo["description"] = info.Description
+	}
+
+	document := map[string]interface{}{
+		"asyncapi":           asyncAPIVersion,
+		"info":               documentInfo,
+		"defaultContentType": "application/json",
+		"channels": map[string]interface{}{
+			info.TopicArn: map[string]interface{}{
+				"description": "Notifications of events saved to the event-store",
+				"bindings": map[string]interface{}{
+					"sns": map[string]string{"bindingVersion": "0.1.0"},
+				},
+				"subscribe": map[string]interface{}{
+					"operationId": "receiveSavedEvents",
+					"message":     map[string]string{"$ref": "#/components/messages/SavedEvents"},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"messages": map[string]interface{}{
+				"SavedEvents": map[string]interface{}{
+					"name":        "SavedEvents",
+					"title":       "Saved events",
+					"summary":     "IDs of the events saved together, by type",
+					"contentType": "application/json",
+					"headers": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"EventTypes"},
+						"properties": map[string]interface{}{
+							"EventTypes": map[string]interface{}{
+								"type":        "array",
+								"items":       map[string]interface{}{"type": "string", "enum": types},
+								"description": "Types of the saved events, as a String.Array message attribute",
+							},
+							"traceparent": map[string]string{
+								"type":        "string",
+								"description": "W3C trace context of the save, when propagated",
+							},
+							"tracestate": map[string]string{
+								"type":        "string",
+								"description": "W3C trace state of the save, when propagated",
+							},
+						},
+					},
+					"payload": map[string]interface{}{
+						"type":                 "object",
+						"properties":           properties,
+						"additionalProperties": false,
+					},
+				},
+			},
+			"schemas": schemas,
+		},
+	}
+
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// rebased copies the schema for it to be embedded at the given location of
+// another document, dropping its dialect and ID and pointing its references
+// there
+func (s *Schema) rebased(base string) *Schema {
+	copied := s.copyRefs(func(ref string) string {
+		if ref == "#" {
+			return base
+		}
+		return base + strings.TrimPrefix(ref, "#")
+	})
+	copied.Dialect = ""
+	copied.ID = ""
+	return copied
+}
+
+// copyRefs deep copies the schema, mapping its references with the given
+// function
+func (s *Schema) copyRefs(mapRef func(string) string) *Schema {
+	if s == nil {
+		return nil
+	}
+
+	copied := *s
+	if copied.Ref != "" {
+		copied.Ref = mapRef(copied.Ref)
+	}
+	copied.Items = s.Items.copyRefs(mapRef)
+	if additional, ok := s.AdditionalProperties.(*Schema); ok {
+		copied.AdditionalProperties = additional.copyRefs(mapRef)
+	}
+	if s.Properties != nil {
+		copied.Properties = map[string]*Schema{}
+		for name, property := range s.Properties {
+			copied.Properties[name] = property.copyRefs(mapRef)
+		}
+	}
+	if s.Defs != nil {
+		copied.Defs = map[string]*Schema{}
+		for name, def := range s.Defs {
+			copied.Defs[name] = def.copyRefs(mapRef)
+		}
+	}
+	copied.AnyOf = nil
+	for _, option := range s.AnyOf {
+		copied.AnyOf = append(copied.AnyOf, option.copyRefs(mapRef))
+	}
+	return &copied
+}
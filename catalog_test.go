@@ -0,0 +1,192 @@
+package es_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/indebted-modules/es"
+	"github.com/stretchr/testify/suite"
+)
+
+// rawMessageType names json.RawMessage the way reflection does
+var rawMessageType = reflect.TypeOf(json.RawMessage{}).String()
+
+type CatalogSuite struct {
+	suite.Suite
+	registry *es.Registry
+}
+
+func TestCatalogSuite(t *testing.T) {
+	suite.Run(t, new(CatalogSuite))
+}
+
+func (s *CatalogSuite) SetupTest() {
+	s.registry = es.NewRegistry()
+	s.Require().NoError(s.registry.Register(SomethingElseHappened{}))
+	s.Require().NoError(s.registry.Register(SomethingHappened{}))
+	s.Require().NoError(s.registry.Register(Registered{}))
+}
+
+func (s *CatalogSuite) TestListsPayloads() {
+	payloads := s.registry.Payloads()
+	s.Equal(3, len(payloads))
+	s.Equal("Registered", payloads[0].Type)
+	s.Equal("Member", payloads[0].AggregateType)
+	s.Equal(2, payloads[0].Version)
+	s.Equal("es_test.Registered", payloads[0].GoType)
+	s.Equal([]es.FieldInfo{
+		{Name: "by", GoType: "string", Type: "string", Required: true},
+		{Name: "name", GoType: "string", Type: "string", Required: true},
+		{Name: "nickname", GoType: "string", Type: "string", Required: false},
+		{Name: "Age", GoType: "int", Type: "string", Required: true},
+		{Name: "score", GoType: "float64", Type: "number", Required: true},
+		{Name: "active", GoType: "bool", Type: "boolean", Required: true},
+		{Name: "tags", GoType: "[]string", Type: "array of string or null", Required: true},
+		{Name: "labels", GoType: "map[string]int", Type: "map of integer or null", Required: true},
+		{Name: "address", GoType: "*es_test.Address", Type: "es_test.Address or null", Required: true},
+		{Name: "previous", GoType: "[]es_test.Address", Type: "array of es_test.Address or null", Required: true},
+		{Name: "referrer", GoType: "*es_test.Registered", Type: "Registered or null", Required: false},
+		{Name: "joined", GoType: "time.Time", Type: "string (date-time)", Required: true},
+		{Name: "extra", GoType: rawMessageType, Type: "any", Required: true},
+	}, payloads[0].Fields)
+	s.Equal("SomethingElseHappened", payloads[1].Type)
+	s.Equal("SomethingHappened", payloads[2].Type)
+}
+
+func (s *CatalogSuite) TestGroupsPayloadsByAggregate() {
+	aggregates := s.registry.PayloadsByAggregate()
+	s.Equal(3, len(aggregates))
+	s.Equal("Registered", aggregates["Member"][0].Type)
+	s.Equal("SomethingHappened", aggregates["SampleAggregate"][0].Type)
+	s.Equal("SomethingElseHappened", aggregates["AnotherSampleAggregate"][0].Type)
+}
+
+func (s *CatalogSuite) TestWritesCatalog() {
+	var catalog strings.Builder
+	err := s.registry.WriteCatalog(&catalog)
+	s.NoError(err)
+	s.Equal(`# Event catalog
+
+## AnotherSampleAggregate
+
+### SomethingElseHappened
+
+Encoded from `+"`es_test.SomethingElseHappened`"+`.
+
+| Field | Type | Required | Go type |
+|---|---|---|---|
+| `+"`Data`"+` | string | yes | `+"`string`"+` |
+
+## Member
+
+### Registered
+
+Version 2, encoded from `+"`es_test.Registered`"+`.
+
+| Field | Type | Required | Go type |
+|---|---|---|---|
+| `+"`by`"+` | string | yes | `+"`string`"+` |
+| `+"`name`"+` | string | yes | `+"`string`"+` |
+| `+"`nickname`"+` | string | no | `+"`string`"+` |
+| `+"`Age`"+` | string | yes | `+"`int`"+` |
+| `+"`score`"+` | number | yes | `+"`float64`"+` |
+| `+"`active`"+` | boolean | yes | `+"`bool`"+` |
+| `+"`tags`"+` | array of string or null | yes | `+"`[]string`"+` |
+| `+"`labels`"+` | map of integer or null | yes | `+"`map[string]int`"+` |
+| `+"`address`"+` | es_test.Address or null | yes | `+"`*es_test.Address`"+` |
+| `+"`previous`"+` | array of es_test.Address or null | yes | `+"`[]es_test.Address`"+` |
+| `+"`referrer`"+` | Registered or null | no | `+"`*es_test.Registered`"+` |
+| `+"`joined`"+` | string (date-time) | yes | `+"`time.Time`"+` |
+| `+"`extra`"+` | any | yes | `+"`"+rawMessageType+"`"+` |
+
+#### es_test.Address
+
+| Field | Type | Required | Go type |
+|---|---|---|---|
+| `+"`City`"+` | string | yes | `+"`string`"+` |
+
+## SampleAggregate
+
+### SomethingHappened
+
+Encoded from `+"`es_test.SomethingHappened`"+`.
+
+| Field | Type | Required | Go type |
+|---|---|---|---|
+| `+"`Data`"+` | string | yes | `+"`string`"+` |
+`, catalog.String())
+}
+
+func (s *CatalogSuite) TestGeneratesAsyncAPI() {
+	data, err := s.registry.AsyncAPI(es.AsyncAPIInfo{
+		Title:    "Members",
+		Version:  "1.0.0",
+		TopicArn: "arn:aws:sns:ap-southeast-2:000000000000:events",
+	})
+	s.Require().NoError(err)
+
+	var document struct {
+		AsyncAPI string `json:"asyncapi"`
+		Channels map[string]struct {
+			Subscribe struct {
+				Message struct {
+					Ref string `json:"$ref"`
+				} `json:"message"`
+			} `json:"subscribe"`
+		} `json:"channels"`
+		Components struct {
+			Messages map[string]struct {
+				Headers struct {
+					Properties struct {
+						EventTypes struct {
+							Items struct {
+								Enum []string `json:"enum"`
+							} `json:"items"`
+						} `json:"EventTypes"`
+					} `json:"properties"`
+				} `json:"headers"`
+				Payload struct {
+					Properties map[string]json.RawMessage `json:"properties"`
+				} `json:"payload"`
+			} `json:"messages"`
+			Schemas map[string]map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	s.Require().NoError(json.Unmarshal(data, &document))
+
+	s.Equal("2.6.0", document.AsyncAPI)
+	channel, ok := document.Channels["arn:aws:sns:ap-southeast-2:000000000000:events"]
+	s.True(ok)
+	s.Equal("#/components/messages/SavedEvents", channel.Subscribe.Message.Ref)
+
+	message := document.Components.Messages["SavedEvents"]
+	s.Equal([]string{"Registered", "SomethingElseHappened", "SomethingHappened"}, message.Headers.Properties.EventTypes.Items.Enum)
+	s.Equal(3, len(message.Payload.Properties))
+
+	registered := document.Components.Schemas["Registered"]
+	s.NotContains(registered, "$schema")
+	s.NotContains(registered, "$id")
+	s.JSONEq(`{
+		"address": {"anyOf": [{"$ref": "#/components/schemas/Registered/$defs/es_test.Address"}, {"type": "null"}]},
+		"referrer": {"anyOf": [{"$ref": "#/components/schemas/Registered"}, {"type": "null"}]}
+	}`, s.pick(registered["properties"], "address", "referrer"))
+
+	schema, err := s.registry.Schema("Registered")
+	s.NoError(err)
+	s.Equal("#", schema.Properties["referrer"].AnyOf[0].Ref, "Registry schemas are left as is")
+}
+
+// pick encodes the given properties of a JSON object only
+func (s *CatalogSuite) pick(data json.RawMessage, names ...string) string {
+	var object map[string]json.RawMessage
+	s.Require().NoError(json.Unmarshal(data, &object))
+	picked := map[string]json.RawMessage{}
+	for _, name := range names {
+		picked[name] = object[name]
+	}
+	encoded, err := json.Marshal(picked)
+	s.Require().NoError(err)
+	return string(encoded)
+}
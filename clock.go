@@ -0,0 +1,97 @@
+package es
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the time events are created at
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to a Clock
+type ClockFunc func() time.Time
+
+// Now implements `Clock`
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock tells the time of the system in UTC
+var SystemClock Clock = ClockFunc(func() time.Time {
+	return time.Now().UTC()
+})
+
+// FixedClock creates a clock always telling the given time
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time {
+		return t
+	})
+}
+
+// NewStepClock creates a clock telling the given start time, then moving
+// forward by the given step every time it's asked. It's safe for concurrent
+// use.
+func NewStepClock(start time.Time, step time.Duration) Clock {
+	return &stepClock{next: start, step: step}
+}
+
+type stepClock struct {
+	mutex sync.Mutex
+	next  time.Time
+	step  time.Duration
+}
+
+func (c *stepClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.next
+	c.next = c.next.Add(c.step)
+	return now
+}
+
+type clockKey struct{}
+
+// WithClock returns a copy of the context carrying the given clock. Drivers
+// stamp saved events with it rather than with their own, overriding the time
+// events were created at.
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+type keepCreatedKey struct{}
+
+// keepCreated returns a copy of the context telling drivers to keep the time
+// saved events were created at, whichever clock they have, such as when
+// moving events between shards
+func keepCreated(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keepCreatedKey{}, true)
+}
+
+// contextClock returns the clock carried by the context, or the given one
+// when there is none. Returns nil when saves keep creation times.
+func contextClock(ctx context.Context, fallback Clock) Clock {
+	if ctx.Value(keepCreatedKey{}) != nil {
+		return nil
+	}
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+	return fallback
+}
+
+// createdAt tells when the given event is saved as created: by the given
+// clock when explicitly set, else as stamped on the event, else by the
+// fallback clock, if any
+func createdAt(event *Event, clock Clock, fallback Clock) time.Time {
+	if clock != nil {
+		return clock.Now()
+	}
+	if !event.Created.IsZero() || fallback == nil {
+		return event.Created
+	}
+	return fallback.Now()
+}
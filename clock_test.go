@@ -0,0 +1,52 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClockSuite struct {
+	suite.Suite
+}
+
+func TestClockSuite(t *testing.T) {
+	suite.Run(t, new(ClockSuite))
+}
+
+func (s *ClockSuite) TestSystemClock() {
+	now := es.SystemClock.Now()
+	s.WithinDuration(time.Now(), now, time.Second)
+	s.Equal(time.UTC, now.Location())
+}
+
+func (s *ClockSuite) TestFixedClock() {
+	t := time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC)
+	clock := es.FixedClock(t)
+	s.Equal(t, clock.Now())
+	s.Equal(t, clock.Now())
+}
+
+func (s *ClockSuite) TestStepClock() {
+	start := time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC)
+	clock := es.NewStepClock(start, time.Minute)
+	s.Equal(start, clock.Now())
+	s.Equal(start.Add(time.Minute), clock.Now())
+	s.Equal(start.Add(2*time.Minute), clock.Now())
+}
+
+func (s *ClockSuite) TestDriversHonourContextClock() {
+	t := time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC)
+	ctx := es.WithClock(context.Background(), es.FixedClock(t))
+	driver := es.NewInMemoryDriver()
+
+	err := driver.SaveContext(ctx, []*es.Event{es.NewEvent("1", &SomethingHappened{}), es.NewEvent("2", &SomethingHappened{})})
+	s.NoError(err)
+
+	for _, event := range driver.Stream() {
+		s.Equal(t, event.Created)
+	}
+}
@@ -1,8 +1,83 @@
 package es
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrOptimisticLocking is matched by errors returned when saving events whose
+// aggregate version has already been taken
+var ErrOptimisticLocking = errors.New("optimistic locking violation")
+
 // Driver interface
 type Driver interface {
 	Load(aggregateID string) ([]*Event, error)
 	Save(events []*Event) error
 	ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error)
 }
+
+// VersionedDriver is implemented by drivers able to cheaply tell the latest
+// version of an aggregate and to load only the events after a given version
+type VersionedDriver interface {
+	Driver
+	LatestVersion(ctx context.Context, aggregateID string) (int64, error)
+	LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*Event, error)
+}
+
+// StreamRemover is implemented by drivers able to remove the whole stream of
+// an aggregate, such as when moving it to another shard
+type StreamRemover interface {
+	RemoveStream(ctx context.Context, aggregateID string) error
+}
+
+// ContextDriver is implemented by drivers propagating a context, such as the
+// current tracing span, to the drivers they decorate. Storing drivers scope
+// loads and reads to the context tenant, see `WithTenant`. They stamp saved
+// events with the context clock, else their own, else keep the time events
+// were created at, and decode loaded events with the context registry, else
+// their own, else `DefaultRegistry`.
+type ContextDriver interface {
+	Driver
+	LoadContext(ctx context.Context, aggregateID string) ([]*Event, error)
+	SaveContext(ctx context.Context, events []*Event) error
+	ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error)
+}
+
+func loadContext(ctx context.Context, driver Driver, aggregateID string) ([]*Event, error) {
+	if d, ok := driver.(ContextDriver); ok {
+		return d.LoadContext(ctx, aggregateID)
+	}
+	return driver.Load(aggregateID)
+}
+
+func saveContext(ctx context.Context, driver Driver, events []*Event) error {
+	if d, ok := driver.(ContextDriver); ok {
+		return d.SaveContext(ctx, events)
+	}
+	return driver.Save(events)
+}
+
+func readEventsOfTypesContext(ctx context.Context, driver Driver, position int64, count uint, types []string) ([]*Event, error) {
+	if d, ok := driver.(ContextDriver); ok {
+		return d.ReadEventsOfTypesContext(ctx, position, count, types)
+	}
+	return driver.ReadEventsOfTypes(position, count, types)
+}
+
+// conflictError marks a driver specific error as an optimistic locking
+// violation, keeping its original message
+type conflictError struct {
+	err error
+}
+
+func (e *conflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *conflictError) Unwrap() error {
+	return e.err
+}
+
+func (e *conflictError) Is(target error) bool {
+	return target == ErrOptimisticLocking
+}
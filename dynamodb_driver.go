@@ -0,0 +1,491 @@
+package es
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// maxTransactItems is the maximum number of items written by a single
+// TransactWriteItems call
+const maxTransactItems = 25
+
+// positionCounter is the stream ID of the item holding the last position
+// taken. Having no `Type`, it never shows in the type index.
+const positionCounter = "$position"
+
+// streamSeparator joins tenants to aggregate IDs in stream IDs, being the
+// ASCII unit separator identifiers never hold
+const streamSeparator = "\x1f"
+
+// typePositionIndex is the global secondary index of events by type and
+// position
+const typePositionIndex = "TypePosition"
+
+// DynamoDBOption configures a DynamoDBDriver
+type DynamoDBOption func(*DynamoDBDriver)
+
+// WithDynamoDBClock sets the clock stamping saved events. Without it, events
+// created at no time are stamped by `SystemClock`.
+func WithDynamoDBClock(clock Clock) DynamoDBOption {
+	return func(d *DynamoDBDriver) {
+		d.clock = clock
+	}
+}
+
+// WithDynamoDBRegistry sets the registry decoding loaded events
+func WithDynamoDBRegistry(registry *Registry) DynamoDBOption {
+	return func(d *DynamoDBDriver) {
+		d.registry = registry
+	}
+}
+
+// WithDynamoDBTenancy requires a tenant on every load, save and read
+func WithDynamoDBTenancy() DynamoDBOption {
+	return func(d *DynamoDBDriver) {
+		d.multiTenant = true
+	}
+}
+
+// WithDynamoDBReadLag holds back reads by type behind events saved within the
+// given lag, which should exceed the longest save and the delay of the type
+// index. It's measured from the time events were saved by the clock of their
+// writer, kept as `Saved`, so it must also cover skew between clocks.
+// Positions being taken before saving, events read without it may be followed
+// by events of lower positions, which readers carrying on after the last
+// position read skip for good. Defaults to 5 seconds.
+func WithDynamoDBReadLag(lag time.Duration) DynamoDBOption {
+	return func(d *DynamoDBDriver) {
+		d.lag = lag
+	}
+}
+
+// NewDynamoDBDriver creates a DynamoDBDriver on the given table
+func NewDynamoDBDriver(client *dynamodb.DynamoDB, table string, options ...DynamoDBOption) *DynamoDBDriver {
+	d := &DynamoDBDriver{
+		client: client,
+		table:  table,
+		lag:    5 * time.Second,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// DynamoDBDriver implements an event-store on a DynamoDB table keyed by
+// stream and version, streams being identified by tenant and aggregate ID.
+// Tenants never take versions of each other's streams. Saves are conditional
+// writes within a single transaction, limited to 25 events. Positions are
+// taken from a counter item before saving, so failed saves leave gaps, and
+// reads by type query the `TypePosition` index, which is eventually
+// consistent. Reads are thus held back by `WithDynamoDBReadLag` for events of
+// lower positions to become readable first.
+type DynamoDBDriver struct {
+	client      *dynamodb.DynamoDB
+	table       string
+	clock       Clock
+	registry    *Registry
+	multiTenant bool
+	lag         time.Duration
+}
+
+type dynamoItem struct {
+	StreamID         string
+	AggregateID      string
+	AggregateVersion int64
+	Position         int64
+	EventID          string `dynamodbav:",omitempty"`
+	TenantID         string `dynamodbav:",omitempty"`
+	Type             string
+	AggregateType    string
+	Created          time.Time
+	Saved            time.Time
+	Payload          string
+}
+
+// CreateTable creates the event-store table with its type index, billed per
+// request
+func (d *DynamoDBDriver) CreateTable() error {
+	_, err := d.client.CreateTable(&dynamodb.CreateTableInput{
+		TableName:   aws.String(d.table),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{AttributeName: aws.String("StreamID"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String("AggregateVersion"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+			{AttributeName: aws.String("Type"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeS)},
+			{AttributeName: aws.String("Position"), AttributeType: aws.String(dynamodb.ScalarAttributeTypeN)},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{AttributeName: aws.String("StreamID"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+			{AttributeName: aws.String("AggregateVersion"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+		},
+		GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(typePositionIndex),
+				KeySchema: []*dynamodb.KeySchemaElement{
+					{AttributeName: aws.String("Type"), KeyType: aws.String(dynamodb.KeyTypeHash)},
+					{AttributeName: aws.String("Position"), KeyType: aws.String(dynamodb.KeyTypeRange)},
+				},
+				Projection: &dynamodb.Projection{ProjectionType: aws.String(dynamodb.ProjectionTypeAll)},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.client.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(d.table)})
+}
+
+// Load loads all events for the given aggregateID ordered by version
+func (d *DynamoDBDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext loads all events for the given aggregateID ordered by version,
+// scoped to the context tenant
+func (d *DynamoDBDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	return d.LoadAfter(ctx, aggregateID, math.MinInt64)
+}
+
+// LatestVersion returns the version of the latest event for the given
+// aggregateID, or zero when there are none, scoped to the context tenant
+func (d *DynamoDBDriver) LatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return 0, err
+	}
+
+	input := d.streamQuery(aggregateID, math.MinInt64, tenantID)
+	input.ScanIndexForward = aws.Bool(false)
+	items, err := d.query(ctx, input, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	return items[0].AggregateVersion, nil
+}
+
+// LoadAfter loads the events for the given aggregateID with a version greater
+// than the given one, ordered by version and scoped to the context tenant
+func (d *DynamoDBDriver) LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := d.query(ctx, d.streamQuery(aggregateID, version, tenantID), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return itemsToEvents(items, contextRegistry(ctx, d.registry))
+}
+
+// Save saves all given events in a single transaction. If any of the events
+// violates optimistic locking, none of them is saved.
+func (d *DynamoDBDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext saves all given events like `Save`, stamping them with the
+// context tenant
+func (d *DynamoDBDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := stampTenant(ctx, events, d.multiTenant)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	if len(events) > maxTransactItems {
+		return fmt.Errorf("cannot save more than %d events at once, got %d", maxTransactItems, len(events))
+	}
+
+	// DynamoDB rejects transactions writing the same item twice
+	taken := map[string]bool{}
+	for _, event := range events {
+		key := fmt.Sprintf("%s/%d", dynamoStreamID(event.TenantID, event.AggregateID), event.AggregateVersion)
+		if taken[key] {
+			return ErrOptimisticLocking
+		}
+		taken[key] = true
+	}
+
+	last, err := d.takePositions(ctx, len(events))
+	if err != nil {
+		return err
+	}
+
+	// Stamped after taking positions, so that lower positions were all taken
+	// at least a read lag before events are read
+	saved := SystemClock.Now()
+	clock := contextClock(ctx, d.clock)
+	created := make([]time.Time, len(events))
+	items := make([]*dynamodb.TransactWriteItem, 0, len(events))
+	for i, event := range events {
+		payload, err := event.marshalPayload()
+		if err != nil {
+			return err
+		}
+
+		created[i] = createdAt(event, clock, SystemClock)
+		item, err := dynamodbattribute.MarshalMap(&dynamoItem{
+			StreamID:         dynamoStreamID(event.TenantID, event.AggregateID),
+			AggregateID:      event.AggregateID,
+			AggregateVersion: event.AggregateVersion,
+			Position:         last - int64(len(events)-1-i),
+			EventID:          event.ID,
+			TenantID:         event.TenantID,
+			Type:             event.Type,
+			AggregateType:    event.AggregateType,
+			Created:          created[i],
+			Saved:            saved,
+			Payload:          string(payload),
+		})
+		if err != nil {
+			return err
+		}
+
+		items = append(items, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(d.table),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(StreamID)"),
+			},
+		})
+	}
+
+	_, err = d.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok &&
+			awsErr.Code() == dynamodb.ErrCodeTransactionCanceledException &&
+			strings.Contains(awsErr.Message(), "ConditionalCheckFailed") {
+			return &conflictError{err: err}
+		}
+		return err
+	}
+
+	for i, event := range events {
+		event.Position = last - int64(len(events)-1-i)
+		event.Created = created[i]
+	}
+	return nil
+}
+
+// RemoveStream deletes all events for the given aggregateID, scoped to the
+// context tenant
+func (d *DynamoDBDriver) RemoveStream(ctx context.Context, aggregateID string) error {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	items, err := d.query(ctx, d.streamQuery(aggregateID, math.MinInt64, tenantID), 0)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		_, err = d.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(d.table),
+			Key: map[string]*dynamodb.AttributeValue{
+				"StreamID":         {S: aws.String(item.StreamID)},
+				"AggregateVersion": {N: aws.String(strconv.FormatInt(item.AggregateVersion, 10))},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadEventsOfTypes reads events of the given types after the given position
+func (d *DynamoDBDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext reads events of the given types after the given
+// position, scoped to the context tenant. Every type is queried on the type
+// index and the results merged by position, up to the first event saved within
+// the read lag.
+func (d *DynamoDBDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	registry := contextRegistry(ctx, d.registry)
+	var items []*dynamoItem
+	seen := map[string]bool{}
+	for _, t := range registry.readTypes(types) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		input := &dynamodb.QueryInput{
+			TableName:              aws.String(d.table),
+			IndexName:              aws.String(typePositionIndex),
+			KeyConditionExpression: aws.String("#type = :type AND Position > :position"),
+			ExpressionAttributeNames: map[string]*string{
+				"#type": aws.String("Type"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":type":     {S: aws.String(t)},
+				":position": {N: aws.String(strconv.FormatInt(position, 10))},
+			},
+		}
+		filterTenant(input, tenantID)
+
+		found, err := d.query(ctx, input, count)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, found...)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Position < items[j].Position
+	})
+	if d.lag > 0 {
+		horizon := SystemClock.Now().Add(-d.lag)
+		for i, item := range items {
+			if item.Saved.After(horizon) {
+				items = items[:i]
+				break
+			}
+		}
+	}
+	if uint(len(items)) > count {
+		items = items[:count]
+	}
+
+	return itemsToEvents(items, registry)
+}
+
+// takePositions atomically increments the position counter by the given
+// number, returning the last position taken
+func (d *DynamoDBDriver) takePositions(ctx context.Context, n int) (int64, error) {
+	output, err := d.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"StreamID":         {S: aws.String(positionCounter)},
+			"AggregateVersion": {N: aws.String("0")},
+		},
+		UpdateExpression: aws.String("ADD Position :n"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":n": {N: aws.String(strconv.Itoa(n))},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(aws.StringValue(output.Attributes["Position"].N), 10, 64)
+}
+
+func (d *DynamoDBDriver) streamQuery(aggregateID string, version int64, tenantID string) *dynamodb.QueryInput {
+	return &dynamodb.QueryInput{
+		TableName:              aws.String(d.table),
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("StreamID = :id AND AggregateVersion > :version"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id":      {S: aws.String(dynamoStreamID(tenantID, aggregateID))},
+			":version": {N: aws.String(strconv.FormatInt(version, 10))},
+		},
+	}
+}
+
+// dynamoStreamID identifies the stream of the given aggregate for the given
+// tenant, the aggregate ID alone identifying it without a tenant
+func dynamoStreamID(tenantID string, aggregateID string) string {
+	if tenantID == "" {
+		return aggregateID
+	}
+	return tenantID + streamSeparator + aggregateID
+}
+
+// query runs the given query page by page until the given number of items,
+// or all of them when zero, is found
+func (d *DynamoDBDriver) query(ctx context.Context, input *dynamodb.QueryInput, count uint) ([]*dynamoItem, error) {
+	var items []*dynamoItem
+	for {
+		if count > 0 {
+			input.Limit = aws.Int64(int64(count) - int64(len(items)))
+		}
+
+		output, err := d.client.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []*dynamoItem
+		err = dynamodbattribute.UnmarshalListOfMaps(output.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		if len(output.LastEvaluatedKey) == 0 || (count > 0 && uint(len(items)) >= count) {
+			return items, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
+// filterTenant restricts the given query to the given tenant, or to items
+// saved without one
+func filterTenant(input *dynamodb.QueryInput, tenantID string) {
+	if tenantID == "" {
+		input.FilterExpression = aws.String("attribute_not_exists(TenantID)")
+		return
+	}
+
+	input.FilterExpression = aws.String("TenantID = :tenant")
+	input.ExpressionAttributeValues[":tenant"] = &dynamodb.AttributeValue{S: aws.String(tenantID)}
+}
+
+// itemsToEvents decodes the given items with the given registry, leaving out
+// those of unknown types skipped by it
+func itemsToEvents(items []*dynamoItem, registry *Registry) ([]*Event, error) {
+	var events []*Event
+	for _, item := range items {
+		event := &Event{
+			ID:               storedID(item.EventID, item.Position),
+			Position:         item.Position,
+			TenantID:         item.TenantID,
+			Type:             item.Type,
+			AggregateID:      item.AggregateID,
+			AggregateType:    item.AggregateType,
+			AggregateVersion: item.AggregateVersion,
+			Created:          item.Created,
+		}
+		keep, err := registry.decodeEvent(event, []byte(item.Payload))
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
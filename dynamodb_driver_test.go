@@ -0,0 +1,191 @@
+package es_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DynamoDBDriverSuite struct {
+	suite.Suite
+	client *dynamodb.DynamoDB
+	table  string
+	driver *es.DynamoDBDriver
+}
+
+func TestDynamoDBDriverSuite(t *testing.T) {
+	suite.Run(t, new(DynamoDBDriverSuite))
+}
+
+func (s *DynamoDBDriverSuite) SetupSuite() {
+	endpoint := "http://localstack:4569"
+	s.Eventually(func() bool {
+		_, err := http.Get(endpoint)
+		return err == nil
+	}, 10*time.Second, time.Second, "Localstack services are not ready or running")
+
+	sess := session.Must(session.NewSession())
+	cred := credentials.NewStaticCredentials("id", "secret", "token")
+	s.client = dynamodb.New(sess, aws.NewConfig().WithRegion("ap-southeast-2").WithCredentials(cred).WithEndpoint(endpoint))
+}
+
+func (s *DynamoDBDriverSuite) SetupTest() {
+	s.table = fmt.Sprintf("events-%d", time.Now().UnixNano())
+	s.driver = es.NewDynamoDBDriver(s.client, s.table, es.WithDynamoDBReadLag(0))
+	err := s.driver.CreateTable()
+	s.Require().NoError(err)
+}
+
+func (s *DynamoDBDriverSuite) TearDownTest() {
+	_, err := s.client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(s.table)})
+	s.NoError(err)
+}
+
+func (s *DynamoDBDriverSuite) TestSaveAndLoad() {
+	events := []*es.Event{
+		s.event("AggregateID#1", 1, "AggregateID#1 - V1"),
+		s.event("AggregateID#2", 1, "AggregateID#2 - V1"),
+		s.event("AggregateID#1", 2, "AggregateID#1 - V2"),
+	}
+	err := s.driver.Save(events)
+	s.NoError(err)
+	s.Equal(int64(3), events[2].Position)
+
+	loaded, err := s.driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal([]*es.Event{events[0], events[2]}, loaded)
+
+	version, err := s.driver.LatestVersion(context.Background(), "AggregateID#1")
+	s.NoError(err)
+	s.Equal(int64(2), version)
+
+	loaded, err = s.driver.LoadAfter(context.Background(), "AggregateID#1", 1)
+	s.NoError(err)
+	s.Equal([]*es.Event{events[2]}, loaded)
+}
+
+func (s *DynamoDBDriverSuite) TestSaveOptimisticLocking() {
+	err := s.driver.Save([]*es.Event{s.event("AggregateID#1", 1, "")})
+	s.NoError(err)
+
+	err = s.driver.Save([]*es.Event{s.event("AggregateID#2", 1, ""), s.event("AggregateID#1", 1, "")})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+	err = s.driver.Save([]*es.Event{s.event("AggregateID#2", 1, ""), s.event("AggregateID#2", 1, "")})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+
+	events, err := s.driver.Load("AggregateID#2")
+	s.NoError(err)
+	s.Empty(events, "Nothing saved on violation")
+}
+
+func (s *DynamoDBDriverSuite) TestReadEventsForward() {
+	err := s.driver.Save([]*es.Event{
+		es.NewEvent("AggregateID#1", &SomethingHappened{Data: "1"}),
+		es.NewEvent("AggregateID#2", &SomethingElseHappened{Data: "2"}),
+		es.NewEvent("AggregateID#3", &SomethingHappened{Data: "3"}),
+	})
+	s.NoError(err)
+
+	events, err := s.driver.ReadEventsOfTypes(0, 2, []string{"SomethingHappened", "SomethingElseHappened"})
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(int64(1), events[0].Position)
+	s.Equal(int64(2), events[1].Position)
+
+	events, err = s.driver.ReadEventsOfTypes(1, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "3"}, events[0].Payload)
+
+	events, err = s.driver.ReadEventsOfTypes(3, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *DynamoDBDriverSuite) TestHoldsBackReadsBehindReadLag() {
+	driver := es.NewDynamoDBDriver(s.client, s.table, es.WithDynamoDBReadLag(time.Second))
+	err := driver.Save([]*es.Event{s.event("AggregateID#1", 1, "1")})
+	s.NoError(err)
+
+	events, err := driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events, "Events saved within the lag are held back")
+	events, err = es.NewDynamoDBDriver(s.client, s.table).ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events, "Reads are held back by default")
+
+	time.Sleep(time.Second)
+	events, err = driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+}
+
+func (s *DynamoDBDriverSuite) TestRemoveStream() {
+	err := s.driver.Save([]*es.Event{s.event("AggregateID#1", 1, "1"), s.event("AggregateID#1", 2, "2")})
+	s.NoError(err)
+
+	err = s.driver.RemoveStream(context.Background(), "AggregateID#1")
+	s.NoError(err)
+
+	events, err := s.driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *DynamoDBDriverSuite) TestTenantIsolation() {
+	driver := es.NewDynamoDBDriver(s.client, s.table, es.WithDynamoDBTenancy(), es.WithDynamoDBReadLag(0))
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+
+	err := driver.SaveContext(acme, []*es.Event{s.event("AggregateID#1", 1, "acme")})
+	s.NoError(err)
+
+	events, err := driver.LoadContext(acme, "AggregateID#1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("acme", events[0].TenantID)
+	events, err = driver.LoadContext(globex, "AggregateID#1")
+	s.NoError(err)
+	s.Empty(events)
+	events, err = driver.ReadEventsOfTypesContext(globex, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events)
+
+	_, err = driver.Load("AggregateID#1")
+	s.Equal(es.ErrTenantRequired, err)
+}
+
+func (s *DynamoDBDriverSuite) event(aggregateID string, version int64, data string) *es.Event {
+	event := es.NewEvent(aggregateID, &SomethingHappened{Data: data})
+	event.AggregateVersion = version
+	return event
+}
+
+func TestDynamoDBDriverConformance(t *testing.T) {
+	sess := session.Must(session.NewSession())
+	cred := credentials.NewStaticCredentials("id", "secret", "token")
+	client := dynamodb.New(sess, aws.NewConfig().WithRegion("ap-southeast-2").WithCredentials(cred).WithEndpoint("http://localstack:4569"))
+
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		table := fmt.Sprintf("events-%d", time.Now().UnixNano())
+		driver := es.NewDynamoDBDriver(client, table, es.WithDynamoDBReadLag(0))
+		require.NoError(t, driver.CreateTable())
+		return driver, func() {
+			_, err := client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(table)})
+			assert.NoError(t, err)
+		}
+	})
+}
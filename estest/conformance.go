@@ -0,0 +1,386 @@
+// Package estest provides helpers for testing event-sourced code, starting
+// with a conformance suite every `es.Driver` is expected to pass.
+package estest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+// registry decodes the events saved by the conformance suite, leaving
+// `es.DefaultRegistry` alone
+var registry = newRegistry()
+
+func newRegistry() *es.Registry {
+	r := es.NewRegistry()
+	for _, payload := range []es.EventPayload{Opened{}, Renamed{}} {
+		err := r.Register(payload)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Opened is an event payload saved by the conformance suite
+type Opened struct {
+	Name string
+}
+
+// PayloadType implements `es.EventPayload`
+func (Opened) PayloadType() string {
+	return "estest.Opened"
+}
+
+// AggregateType implements `es.EventPayload`
+func (Opened) AggregateType() string {
+	return "estest.Account"
+}
+
+// Renamed is an event payload saved by the conformance suite
+type Renamed struct {
+	Name string
+}
+
+// PayloadType implements `es.EventPayload`
+func (Renamed) PayloadType() string {
+	return "estest.Renamed"
+}
+
+// AggregateType implements `es.EventPayload`
+func (Renamed) AggregateType() string {
+	return "estest.Account"
+}
+
+// unregistered is never registered, so that it can't be decoded
+type unregistered struct {
+	Name string
+}
+
+func (unregistered) PayloadType() string {
+	return "estest.Unregistered"
+}
+
+func (unregistered) AggregateType() string {
+	return "estest.Account"
+}
+
+// Factory creates an empty driver for a single test, along with a function
+// releasing it once the test is over, which may be nil
+type Factory func(t *testing.T) (es.Driver, func())
+
+// Run runs the conformance suite against the drivers created by the given
+// factory, one per test. Drivers must store aggregate IDs as UUIDs. Events
+// are decoded with a registry of the suite carried by the context, so drivers
+// not implementing `es.ContextDriver` need `Opened` and `Renamed` registered
+// in `es.DefaultRegistry`.
+func Run(t *testing.T, factory Factory) {
+	suite.Run(t, &conformanceSuite{factory: factory})
+}
+
+type conformanceSuite struct {
+	suite.Suite
+	factory Factory
+	driver  es.Driver
+	release func()
+}
+
+func (s *conformanceSuite) SetupTest() {
+	s.driver, s.release = s.factory(s.T())
+}
+
+func (s *conformanceSuite) TearDownTest() {
+	if s.release != nil {
+		s.release()
+	}
+}
+
+func (s *conformanceSuite) TestLoadsNothingForUnknownAggregates() {
+	events, err := s.load(context.Background(), uuid.NewID())
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *conformanceSuite) TestRoundTripsEvents() {
+	id := uuid.NewID()
+	err := s.driver.Save([]*es.Event{s.event(id, 1, &Opened{Name: "Savings"})})
+	s.Require().NoError(err)
+
+	events, err := s.load(context.Background(), id)
+	s.Require().NoError(err)
+	s.Require().Equal(1, len(events))
+	s.Equal("estest.Opened", events[0].Type)
+	s.Equal(id, events[0].AggregateID)
+	s.Equal("estest.Account", events[0].AggregateType)
+	s.Equal(int64(1), events[0].AggregateVersion)
+	s.Equal(&Opened{Name: "Savings"}, events[0].Payload)
+	s.False(events[0].Created.IsZero(), "Created is set")
+	s.True(events[0].Position > 0, "Position is set")
+}
+
+func (s *conformanceSuite) TestKeepsIDsAndCreationTimes() {
+	id := uuid.NewID()
+	created := time.Date(2020, time.March, 4, 5, 6, 7, 8000, time.UTC)
+	event := es.NewEvent(id, &Opened{}, es.WithEventClock(es.FixedClock(created)), es.WithEventRegistry(registry))
+	event.AggregateVersion = 1
+	err := s.driver.Save([]*es.Event{event})
+	s.Require().NoError(err)
+
+	events, err := s.load(context.Background(), id)
+	s.Require().NoError(err)
+	s.Require().Equal(1, len(events))
+	s.Equal(event.ID, events[0].ID, "IDs are kept")
+	s.True(created.Equal(events[0].Created), "Creation times are kept, got %v", events[0].Created)
+	events, err = s.read(context.Background(), 0, 10, []string{"estest.Opened"})
+	s.Require().NoError(err)
+	s.Require().Equal(1, len(events))
+	s.Equal(event.ID, events[0].ID, "IDs are kept")
+}
+
+func (s *conformanceSuite) TestLoadsEventsOrderedByVersion() {
+	id := uuid.NewID()
+	other := uuid.NewID()
+	err := s.driver.Save([]*es.Event{s.event(id, 2, &Renamed{Name: "2"}), s.event(other, 1, &Opened{})})
+	s.Require().NoError(err)
+	err = s.driver.Save([]*es.Event{s.event(id, 1, &Opened{Name: "1"}), s.event(id, 3, &Renamed{Name: "3"})})
+	s.Require().NoError(err)
+
+	events, err := s.load(context.Background(), id)
+	s.Require().NoError(err)
+	s.Require().Equal(3, len(events))
+	for i, event := range events {
+		s.Equal(id, event.AggregateID)
+		s.Equal(int64(i+1), event.AggregateVersion)
+	}
+}
+
+func (s *conformanceSuite) TestRejectsConflictingVersions() {
+	id := uuid.NewID()
+	err := s.driver.Save([]*es.Event{s.event(id, 1, &Opened{})})
+	s.Require().NoError(err)
+
+	err = s.driver.Save([]*es.Event{s.event(id, 1, &Renamed{})})
+	s.True(errors.Is(err, es.ErrOptimisticLocking), "Conflict with a saved version, got %v", err)
+
+	err = s.driver.Save([]*es.Event{s.event(id, 2, &Renamed{}), s.event(id, 2, &Renamed{})})
+	s.True(errors.Is(err, es.ErrOptimisticLocking), "Conflict within a save, got %v", err)
+}
+
+func (s *conformanceSuite) TestKeepsStreamsPerTenant() {
+	driver, ok := s.driver.(es.ContextDriver)
+	if !ok {
+		s.T().Skip("Tenants are carried by the context")
+	}
+
+	id := uuid.NewID()
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+	err := driver.SaveContext(acme, []*es.Event{s.event(id, 1, &Opened{Name: "acme"})})
+	s.Require().NoError(err)
+
+	err = driver.SaveContext(globex, []*es.Event{s.event(id, 1, &Opened{Name: "globex"}), s.event(id, 2, &Renamed{Name: "globex"})})
+	s.Require().NoError(err, "Versions are taken per tenant")
+	err = driver.SaveContext(acme, []*es.Event{s.event(id, 2, &Renamed{Name: "acme"})})
+	s.Require().NoError(err, "Streams are not appended to by other tenants")
+	err = driver.SaveContext(acme, []*es.Event{s.event(id, 2, &Renamed{})})
+	s.True(errors.Is(err, es.ErrOptimisticLocking), "Conflict within the tenant, got %v", err)
+
+	events, err := s.load(acme, id)
+	s.Require().NoError(err)
+	s.Require().Equal(2, len(events))
+	s.Equal(&Opened{Name: "acme"}, events[0].Payload)
+	s.Equal(&Renamed{Name: "acme"}, events[1].Payload)
+	events, err = s.load(globex, id)
+	s.Require().NoError(err)
+	s.Require().Equal(2, len(events))
+	s.Equal(&Opened{Name: "globex"}, events[0].Payload)
+	s.Equal(&Renamed{Name: "globex"}, events[1].Payload)
+}
+
+func (s *conformanceSuite) TestKeepsEventsWithoutTenantApart() {
+	driver, ok := s.driver.(es.ContextDriver)
+	if !ok {
+		s.T().Skip("Tenants are carried by the context")
+	}
+
+	id := uuid.NewID()
+	acme := es.WithTenant(context.Background(), "acme")
+	err := driver.SaveContext(acme, []*es.Event{s.event(id, 1, &Opened{Name: "acme"}), s.event(id, 2, &Renamed{Name: "acme"})})
+	s.Require().NoError(err)
+	err = driver.Save([]*es.Event{s.event(id, 1, &Opened{Name: "none"})})
+	s.Require().NoError(err, "Events without tenant take their own versions")
+
+	events, err := s.load(context.Background(), id)
+	s.Require().NoError(err)
+	s.Require().Equal(1, len(events), "Loads without tenant only see events saved without one")
+	s.Equal(&Opened{Name: "none"}, events[0].Payload)
+	if versioned, ok := s.driver.(es.VersionedDriver); ok {
+		version, err := versioned.LatestVersion(context.Background(), id)
+		s.Require().NoError(err)
+		s.Equal(int64(1), version)
+		events, err = versioned.LoadAfter(es.WithRegistry(context.Background(), registry), id, 0)
+		s.Require().NoError(err)
+		s.Equal(1, len(events))
+	}
+
+	events, err = s.read(context.Background(), 0, 10, []string{"estest.Opened", "estest.Renamed"})
+	s.Require().NoError(err)
+	s.Require().Equal(1, len(events), "Reads without tenant only see events saved without one")
+	s.Equal(&Opened{Name: "none"}, events[0].Payload)
+	events, err = s.read(acme, 0, 10, []string{"estest.Opened", "estest.Renamed"})
+	s.Require().NoError(err)
+	s.Equal(2, len(events))
+}
+
+func (s *conformanceSuite) TestSavesAtomically() {
+	id := uuid.NewID()
+	err := s.driver.Save([]*es.Event{s.event(id, 1, &Opened{})})
+	s.Require().NoError(err)
+
+	err = s.driver.Save([]*es.Event{
+		s.event(id, 2, &Renamed{}),
+		s.event(id, 3, &Renamed{}),
+		s.event(id, 1, &Renamed{}),
+	})
+	s.Error(err)
+
+	events, err := s.load(context.Background(), id)
+	s.Require().NoError(err)
+	s.Equal(1, len(events), "Nothing saved on failure")
+	events, err = s.read(context.Background(), 0, 10, []string{"estest.Renamed"})
+	s.Require().NoError(err)
+	s.Empty(events, "Nothing readable on failure")
+}
+
+func (s *conformanceSuite) TestAssignsIncreasingPositions() {
+	first := uuid.NewID()
+	second := uuid.NewID()
+	err := s.driver.Save([]*es.Event{s.event(first, 1, &Opened{}), s.event(second, 1, &Opened{})})
+	s.Require().NoError(err)
+	err = s.driver.Save([]*es.Event{s.event(first, 2, &Renamed{})})
+	s.Require().NoError(err)
+	err = s.driver.Save([]*es.Event{s.event(second, 2, &Renamed{})})
+	s.Require().NoError(err)
+
+	events, err := s.read(context.Background(), 0, 10, []string{"estest.Opened", "estest.Renamed"})
+	s.Require().NoError(err)
+	s.Require().Equal(4, len(events))
+	expected := []string{first + "/1", second + "/1", first + "/2", second + "/2"}
+	global := s.globalPositions()
+	previous := int64(0)
+	for i, event := range events {
+		s.Equal(expected[i], event.AggregateID+"/"+strconv.FormatInt(event.AggregateVersion, 10), "Read in save order")
+		if global {
+			s.True(event.Position > previous, "Position %d after %d", event.Position, previous)
+			previous = event.Position
+		}
+	}
+}
+
+func (s *conformanceSuite) TestReadsAfterPosition() {
+	if !s.globalPositions() {
+		s.T().Skip("Reads resume from a `ShardCursor`")
+	}
+
+	var saved []string
+	for i := 0; i < 12; i++ {
+		id := uuid.NewID()
+		err := s.driver.Save([]*es.Event{s.event(id, 1, &Opened{Name: id})})
+		s.Require().NoError(err)
+		saved = append(saved, id)
+	}
+
+	var read []string
+	position := int64(0)
+	for page := 0; page < 10; page++ {
+		events, err := s.read(context.Background(), position, 5, []string{"estest.Opened"})
+		s.Require().NoError(err)
+		s.True(len(events) <= 5, "Reads at most count events")
+		if len(events) == 0 {
+			break
+		}
+
+		for _, event := range events {
+			read = append(read, event.AggregateID)
+			position = event.Position
+		}
+	}
+	s.Equal(saved, read, "Every event read once, after the given position")
+
+	events, err := s.read(context.Background(), position, 5, []string{"estest.Opened"})
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *conformanceSuite) TestFiltersByType() {
+	id := uuid.NewID()
+	err := s.driver.Save([]*es.Event{
+		s.event(id, 1, &Opened{}),
+		s.event(id, 2, &Renamed{Name: "2"}),
+		s.event(id, 3, &Renamed{Name: "3"}),
+	})
+	s.Require().NoError(err)
+
+	events, err := s.read(context.Background(), 0, 10, []string{"estest.Renamed"})
+	s.Require().NoError(err)
+	s.Require().Equal(2, len(events))
+	s.Equal(&Renamed{Name: "2"}, events[0].Payload)
+	s.Equal(&Renamed{Name: "3"}, events[1].Payload)
+
+	events, err = s.read(context.Background(), 0, 10, []string{"estest.Closed"})
+	s.NoError(err)
+	s.Empty(events, "No events of unknown types")
+
+	events, err = s.read(context.Background(), 0, 10, []string{})
+	s.NoError(err)
+	s.Empty(events, "No events without types")
+}
+
+func (s *conformanceSuite) TestFailsDecodingUnregisteredTypes() {
+	id := uuid.NewID()
+	err := s.driver.Save([]*es.Event{s.event(id, 1, &unregistered{Name: "?"})})
+	s.Require().NoError(err)
+
+	_, err = s.load(context.Background(), id)
+	s.Error(err)
+	_, err = s.read(context.Background(), 0, 10, []string{"estest.Unregistered"})
+	s.Error(err)
+}
+
+// load loads the events of the given aggregate, decoded with the suite
+// registry by drivers taking a context
+func (s *conformanceSuite) load(ctx context.Context, aggregateID string) ([]*es.Event, error) {
+	if driver, ok := s.driver.(es.ContextDriver); ok {
+		return driver.LoadContext(es.WithRegistry(ctx, registry), aggregateID)
+	}
+	return s.driver.Load(aggregateID)
+}
+
+// read reads events of the given types after the given position, decoded
+// with the suite registry by drivers taking a context
+func (s *conformanceSuite) read(ctx context.Context, position int64, count uint, types []string) ([]*es.Event, error) {
+	if driver, ok := s.driver.(es.ContextDriver); ok {
+		return driver.ReadEventsOfTypesContext(es.WithRegistry(ctx, registry), position, count, types)
+	}
+	return s.driver.ReadEventsOfTypes(position, count, types)
+}
+
+// globalPositions tells whether the driver reads after positions, rather
+// than failing with `es.ErrShardedPosition`
+func (s *conformanceSuite) globalPositions() bool {
+	_, err := s.read(context.Background(), 1, 1, []string{"estest.Opened"})
+	return !errors.Is(err, es.ErrShardedPosition)
+}
+
+func (s *conformanceSuite) event(aggregateID string, version int64, payload es.EventPayload) *es.Event {
+	event := es.NewEvent(aggregateID, payload, es.WithEventRegistry(registry))
+	event.AggregateVersion = version
+	return event
+}
@@ -0,0 +1,117 @@
+package estest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/indebted-modules/es"
+	"github.com/stretchr/testify/assert"
+)
+
+// applier is implemented by aggregates embedding `es.Versionable`
+type applier interface {
+	Apply(aggregate es.Aggregate, events []*es.Event) []*es.AppliedEvent
+}
+
+// Command runs against the aggregate of a scenario, returning the events it
+// applied or why it was rejected
+type Command func() ([]*es.AppliedEvent, error)
+
+// Scenario tests an aggregate given its history, when running a command,
+// then expecting the events or error it results in:
+//
+//	account := &Account{}
+//	estest.NewScenario(t, account).
+//		Given(&Opened{Name: "Checking"}).
+//		When(func() ([]*es.AppliedEvent, error) { return account.Rename("Savings") }).
+//		Then(&Renamed{Name: "Savings"})
+type Scenario struct {
+	t         testing.TB
+	aggregate es.Aggregate
+	version   int64
+	applied   []*es.AppliedEvent
+	err       error
+	ran       bool
+}
+
+// NewScenario creates a scenario for the given aggregate, which must embed
+// `es.Versionable`
+func NewScenario(t testing.TB, aggregate es.Aggregate) *Scenario {
+	return &Scenario{t: t, aggregate: aggregate}
+}
+
+// Given reduces the given payloads into the aggregate as its history
+func (s *Scenario) Given(payloads ...es.EventPayload) *Scenario {
+	s.t.Helper()
+	versionable, ok := s.aggregate.(applier)
+	if !ok {
+		s.t.Fatalf("Aggregate %T does not embed es.Versionable", s.aggregate)
+		return s
+	}
+
+	events := []*es.Event{}
+	for _, payload := range payloads {
+		events = append(events, es.NewEvent("", payload))
+	}
+	versionable.Apply(s.aggregate, events)
+	s.version += int64(len(events))
+	return s
+}
+
+// When runs the given command against the aggregate
+func (s *Scenario) When(command Command) *Scenario {
+	s.applied, s.err = command()
+	s.ran = true
+	return s
+}
+
+// Then expects the command to have succeeded, applying events with the given
+// payloads in order and versioned after the history
+func (s *Scenario) Then(expected ...es.EventPayload) {
+	s.t.Helper()
+	if !s.ran {
+		s.t.Errorf("Scenario has no command, call When before Then")
+		return
+	}
+	if !assert.NoError(s.t, s.err, "Command failed") {
+		return
+	}
+
+	expectedPayloads := []interface{}{}
+	for _, payload := range expected {
+		expectedPayloads = append(expectedPayloads, payload)
+	}
+	payloads := []interface{}{}
+	for _, applied := range s.applied {
+		payloads = append(payloads, applied.Event.Payload)
+	}
+	if !assert.Equal(s.t, expectedPayloads, payloads, "Applied events") {
+		return
+	}
+
+	for i, applied := range s.applied {
+		event := applied.Event
+		payload := expected[i]
+		assert.Equal(s.t, s.version+int64(i+1), event.AggregateVersion, "Version of applied event #%d (%s)", i+1, event.Type)
+		assert.Equal(s.t, payload.PayloadType(), event.Type, "Type of applied event #%d", i+1)
+		assert.Equal(s.t, payload.AggregateType(), event.AggregateType, "Aggregate type of applied event #%d", i+1)
+	}
+}
+
+// ThenError expects the command to have been rejected with an error matching
+// the given one by `errors.Is`, applying no events
+func (s *Scenario) ThenError(expected error) {
+	s.t.Helper()
+	if !s.ran {
+		s.t.Errorf("Scenario has no command, call When before ThenError")
+		return
+	}
+	if s.err == nil {
+		s.t.Errorf("Command succeeded, expected error %q", expected)
+		return
+	}
+	if !errors.Is(s.err, expected) {
+		s.t.Errorf("Command failed with %q, expected error %q", s.err, expected)
+	}
+	assert.Empty(s.t, s.applied, "Applied events of a rejected command")
+}
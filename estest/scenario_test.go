@@ -0,0 +1,146 @@
+package estest_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/suite"
+)
+
+var errClosed = errors.New("account is closed")
+
+type Account struct {
+	es.Versionable
+	Name   string
+	Closed bool
+}
+
+func (a *Account) Reduce(typ string, payload interface{}) {
+	switch typ {
+	case "estest.Opened":
+		a.Name = payload.(*estest.Opened).Name
+	case "estest.Renamed":
+		a.Name = payload.(*estest.Renamed).Name
+	}
+}
+
+func (a *Account) Rename(names ...string) ([]*es.AppliedEvent, error) {
+	if a.Closed {
+		return nil, errClosed
+	}
+
+	events := []*es.Event{}
+	for _, name := range names {
+		if name == a.Name {
+			continue
+		}
+		events = append(events, es.NewEvent("1", &estest.Renamed{Name: name}))
+	}
+	return a.Apply(a, events), nil
+}
+
+// recorder records failures instead of failing the test running it
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Name() string {
+	return "recorder"
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+}
+
+type ScenarioSuite struct {
+	suite.Suite
+}
+
+func TestScenarioSuite(t *testing.T) {
+	suite.Run(t, new(ScenarioSuite))
+}
+
+func (s *ScenarioSuite) TestPassesWhenAppliedEventsMatch() {
+	account := &Account{}
+	estest.NewScenario(s.T(), account).
+		Given(&estest.Opened{Name: "Checking"}, &estest.Renamed{Name: "Savings"}).
+		When(func() ([]*es.AppliedEvent, error) { return account.Rename("Savings", "Holidays", "Rainy days") }).
+		Then(&estest.Renamed{Name: "Holidays"}, &estest.Renamed{Name: "Rainy days"})
+	s.Equal("Rainy days", account.Name)
+}
+
+func (s *ScenarioSuite) TestPassesWhenRejectedWithError() {
+	account := &Account{Closed: true}
+	estest.NewScenario(s.T(), account).
+		Given(&estest.Opened{Name: "Checking"}).
+		When(func() ([]*es.AppliedEvent, error) { return account.Rename("Savings") }).
+		ThenError(errClosed)
+}
+
+func (s *ScenarioSuite) TestFailsShowingDiffOfPayloads() {
+	t := &recorder{}
+	account := &Account{}
+	estest.NewScenario(t, account).
+		Given(&estest.Opened{Name: "Checking"}).
+		When(func() ([]*es.AppliedEvent, error) { return account.Rename("Savings") }).
+		Then(&estest.Renamed{Name: "Holidays"})
+
+	s.Equal(1, len(t.failures))
+	s.Contains(t.failures[0], "Applied events")
+	s.Contains(t.failures[0], `-  Name: (string) (len=8) "Holidays"`)
+	s.Contains(t.failures[0], `+  Name: (string) (len=7) "Savings"`)
+}
+
+func (s *ScenarioSuite) TestFailsOnWrongVersions() {
+	t := &recorder{}
+	account := &Account{}
+	estest.NewScenario(t, account).
+		Given(&estest.Opened{Name: "Checking"}).
+		When(func() ([]*es.AppliedEvent, error) {
+			event := es.NewEvent("1", &estest.Renamed{Name: "Savings"})
+			event.AggregateVersion = 1
+			return []*es.AppliedEvent{{Event: event}}, nil
+		}).
+		Then(&estest.Renamed{Name: "Savings"})
+
+	s.Equal(1, len(t.failures))
+	s.Contains(t.failures[0], "Version of applied event #1 (estest.Renamed)")
+}
+
+func (s *ScenarioSuite) TestFailsOnUnexpectedOutcome() {
+	t := &recorder{}
+	account := &Account{Closed: true}
+	estest.NewScenario(t, account).
+		When(func() ([]*es.AppliedEvent, error) { return account.Rename("Savings") }).
+		Then(&estest.Renamed{Name: "Savings"})
+	s.Equal(1, len(t.failures))
+	s.Contains(t.failures[0], "Command failed")
+
+	t = &recorder{}
+	account = &Account{}
+	estest.NewScenario(t, account).
+		When(func() ([]*es.AppliedEvent, error) { return account.Rename("Savings") }).
+		ThenError(errClosed)
+	s.Equal([]string{`Command succeeded, expected error "account is closed"`}, t.failures)
+
+	t = &recorder{}
+	estest.NewScenario(t, account).Then()
+	s.Equal([]string{"Scenario has no command, call When before Then"}, t.failures)
+}
+
+func (s *ScenarioSuite) TestRequiresVersionableAggregates() {
+	t := &recorder{}
+	estest.NewScenario(t, &struct{ es.Aggregate }{}).Given(&estest.Opened{})
+	s.Equal(1, len(t.failures))
+	s.Contains(t.failures[0], "does not embed es.Versionable")
+}
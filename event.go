@@ -1,9 +1,9 @@
 package es
 
 import (
+	"encoding/json"
+	"strconv"
 	"time"
-
-	"github.com/indebted-modules/uuid"
 )
 
 // EventPayload interface
@@ -12,27 +12,124 @@ type EventPayload interface {
 	AggregateType() string
 }
 
-// Event model
+// Event model. `Position` is the global position drivers save the event at,
+// which `ReadEventsOfTypes` reads after. Events loaded through a registry
+// decoding lazily have no `Payload` until `DecodePayload` is called.
 type Event struct {
 	ID               string
+	Position         int64
+	TenantID         string
 	Type             string
 	AggregateID      string
 	AggregateType    string
 	AggregateVersion int64
 	Payload          interface{}
 	Created          time.Time
+
+	raw      []byte
+	registry *Registry
+	err      error
+}
+
+// DecodePayload returns the payload of the event, decoding and keeping it as
+// `Payload` first when loaded lazily. It's not safe for concurrent use on the
+// same event.
+func (e *Event) DecodePayload() (interface{}, error) {
+	if e.raw == nil {
+		return e.Payload, nil
+	}
+
+	payload, err := e.registry.Decode(e.Type, e.raw)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Payload, e.raw, e.registry = payload, nil, nil
+	return payload, nil
+}
+
+// Err returns what `NewEvent` found wrong with the payload of the event, as
+// an `*EventError`, or nil when valid
+func (e *Event) Err() error {
+	return e.err
+}
+
+// marshalPayload encodes the payload of the event, as loaded when not
+// decoded yet
+func (e *Event) marshalPayload() ([]byte, error) {
+	if e.raw != nil {
+		return e.raw, nil
+	}
+	return json.Marshal(e.Payload)
+}
+
+// EventOption configures how NewEvent creates an event
+type EventOption func(*eventOptions)
+
+type eventOptions struct {
+	clock    Clock
+	ids      IDGenerator
+	registry *Registry
 }
 
-// NewEvent creates a new event
-func NewEvent(aggregateID string, payload EventPayload) *Event {
-	// TODO: validate if payload is a pointer
+// WithEventClock sets the clock telling when the event is created. Defaults
+// to `SystemClock`.
+func WithEventClock(clock Clock) EventOption {
+	return func(o *eventOptions) {
+		o.clock = clock
+	}
+}
+
+// WithEventIDs sets the generator of the event ID. Defaults to random UUIDs.
+func WithEventIDs(ids IDGenerator) EventOption {
+	return func(o *eventOptions) {
+		o.ids = ids
+	}
+}
+
+// WithEventRegistry sets the registry validating the payload. Defaults to
+// `DefaultRegistry`.
+func WithEventRegistry(registry *Registry) EventOption {
+	return func(o *eventOptions) {
+		o.registry = registry
+	}
+}
+
+// NewEvent creates a new event, validating its payload the way
+// `Registry.ValidateEvents` does with the event registry. What's wrong with
+// it, if anything, is returned by `Err` for early feedback only, as
+// `Store.Save` validates events again with its own registry, which alone
+// decides whether they are saved.
+func NewEvent(aggregateID string, payload EventPayload, options ...EventOption) *Event {
+	o := &eventOptions{
+		clock:    SystemClock,
+		ids:      UUIDv4Generator,
+		registry: DefaultRegistry,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
 	event := &Event{
-		ID:            uuid.NewID(),
+		ID:            o.ids.NewID(),
 		Type:          payload.PayloadType(),
 		AggregateID:   aggregateID,
 		AggregateType: payload.AggregateType(),
 		Payload:       payload,
-		Created:       time.Now(),
+		Created:       o.clock.Now(),
+	}
+	errs := o.registry.validateEvent(event)
+	if len(errs) > 0 {
+		event.err = &EventError{Event: event, Errors: errs}
 	}
 	return event
 }
+
+// storedID returns the ID an event was saved with, or its position for those
+// saved before drivers kept IDs
+func storedID(id string, position int64) string {
+	if id == "" {
+		return strconv.FormatInt(position, 10)
+	}
+	return id
+}
@@ -27,6 +27,7 @@ func (s *EventSuite) TestNewEvent() {
 	s.Equal(int64(0), firstEvent.AggregateVersion)
 	s.Same(somethingHappened, firstEvent.Payload)
 	s.WithinDuration(time.Now(), firstEvent.Created, time.Millisecond*200)
+	s.Equal(time.UTC, firstEvent.Created.Location())
 
 	somethingElseHappened := &SomethingElseHappened{}
 	secondEvent := es.NewEvent("another-aggregate-id", somethingElseHappened)
@@ -41,3 +42,22 @@ func (s *EventSuite) TestNewEvent() {
 	s.NotEqual(firstEvent.ID, secondEvent.ID)
 	s.NotEqual(firstEvent.Created, secondEvent.Created)
 }
+
+func (s *EventSuite) TestNewEventWithClockAndIDs() {
+	created := time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC)
+	event := es.NewEvent(
+		"aggregate-id",
+		&SomethingHappened{},
+		es.WithEventClock(es.FixedClock(created)),
+		es.WithEventIDs(es.IDGeneratorFunc(func() string { return "event-id" })),
+	)
+	s.Equal("event-id", event.ID)
+	s.Equal(created, event.Created)
+}
+
+func (s *EventSuite) TestDecodePayloadReturnsDecodedPayload() {
+	event := es.NewEvent("aggregate-id", &SomethingHappened{Data: "data"})
+	payload, err := event.DecodePayload()
+	s.NoError(err)
+	s.Equal(&SomethingHappened{Data: "data"}, payload)
+}
@@ -0,0 +1,206 @@
+package es
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/rs/zerolog/log"
+)
+
+// maxPutEventsEntries is the maximum number of entries accepted by a single
+// PutEvents call
+const maxPutEventsEntries = 10
+
+// maxPutEventsSize is the maximum total size in bytes of the entries accepted
+// by a single PutEvents call
+const maxPutEventsSize = 256 * 1024
+
+// maxPutEventsAttempts is the number of times failed entries are sent before
+// giving up on them
+const maxPutEventsAttempts = 3
+
+// putEventsBackoff is the wait before sending failed entries again, doubled
+// on every attempt up to maxPutEventsBackoff
+const (
+	putEventsBackoff    = 100 * time.Millisecond
+	maxPutEventsBackoff = time.Second
+)
+
+// NewEventBridgeDriver creates an EventBridgeDriver
+func NewEventBridgeDriver(client *eventbridge.EventBridge, eventBusName string, driver Driver) *EventBridgeDriver {
+	return &EventBridgeDriver{
+		client:       client,
+		eventBusName: eventBusName,
+		driver:       driver,
+	}
+}
+
+// EventBridgeDriver creates a driver decorator that puts every saved event
+// in AWS' EventBridge. Events are sent with their `AggregateType` as `Source`,
+// their `Type` as `DetailType` and their payload as `Detail`.
+type EventBridgeDriver struct {
+	client       *eventbridge.EventBridge
+	eventBusName string
+	driver       Driver
+}
+
+// Load delegates to internal driver
+func (d *EventBridgeDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (d *EventBridgeDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	return loadContext(ctx, d.driver, aggregateID)
+}
+
+// Save delegates to internal driver. If successful, it'll put all events in
+// batches of up to 10 entries and 256KB, retrying entries that failed
+// individually with exponential backoff.
+func (d *EventBridgeDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (d *EventBridgeDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := saveContext(ctx, d.driver, events)
+	if err != nil {
+		return err
+	}
+
+	entries := []*eventbridge.PutEventsRequestEntry{}
+	for _, event := range events {
+		entry, err := d.toEntry(event)
+		if err != nil {
+			log.
+				Warn().
+				Err(err).
+				Str("EventID", event.ID).
+				Str("EventType", event.Type).
+				Msg("Failed marshaling event detail")
+
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	start, size := 0, 0
+	for end, entry := range entries {
+		entrySize := putEventsEntrySize(entry)
+		if end-start == maxPutEventsEntries || (end > start && size+entrySize > maxPutEventsSize) {
+			d.putEvents(ctx, entries[start:end])
+			start, size = end, 0
+		}
+		size += entrySize
+	}
+	if start < len(entries) {
+		d.putEvents(ctx, entries[start:])
+	}
+
+	return nil
+}
+
+// ReadEventsOfTypes .
+func (d *EventBridgeDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *EventBridgeDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	return readEventsOfTypesContext(ctx, d.driver, position, count, types)
+}
+
+func (d *EventBridgeDriver) putEvents(ctx context.Context, entries []*eventbridge.PutEventsRequestEntry) {
+	backoff := putEventsBackoff
+	for attempt := 1; len(entries) > 0; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				log.
+					Warn().
+					Err(ctx.Err()).
+					Int("Entries", len(entries)).
+					Msg("Gave up putting events to EventBridge")
+
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > maxPutEventsBackoff {
+				backoff = maxPutEventsBackoff
+			}
+		}
+
+		response, err := d.client.PutEvents(&eventbridge.PutEventsInput{
+			Entries: entries,
+		})
+		if err != nil {
+			log.
+				Warn().
+				Err(err).
+				Int("Entries", len(entries)).
+				Msg("Failed putting events to EventBridge")
+
+			return
+		}
+		if aws.Int64Value(response.FailedEntryCount) == 0 {
+			return
+		}
+
+		failed := []*eventbridge.PutEventsRequestEntry{}
+		for i, result := range response.Entries {
+			if result.ErrorCode == nil {
+				continue
+			}
+			if attempt == maxPutEventsAttempts {
+				log.
+					Warn().
+					Str("DetailType", aws.StringValue(entries[i].DetailType)).
+					Str("Source", aws.StringValue(entries[i].Source)).
+					Str("ErrorCode", aws.StringValue(result.ErrorCode)).
+					Str("ErrorMessage", aws.StringValue(result.ErrorMessage)).
+					Msg("Failed putting event to EventBridge")
+
+				continue
+			}
+			failed = append(failed, entries[i])
+		}
+		entries = failed
+	}
+}
+
+// putEventsEntrySize returns the size of the given entry the way PutEvents
+// counts it against its limit
+func putEventsEntrySize(entry *eventbridge.PutEventsRequestEntry) int {
+	size := len(aws.StringValue(entry.Source)) +
+		len(aws.StringValue(entry.DetailType)) +
+		len(aws.StringValue(entry.Detail))
+	if entry.Time != nil {
+		size += 14
+	}
+	for _, resource := range entry.Resources {
+		size += len(aws.StringValue(resource))
+	}
+	return size
+}
+
+func (d *EventBridgeDriver) toEntry(event *Event) (*eventbridge.PutEventsRequestEntry, error) {
+	detail, err := event.marshalPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &eventbridge.PutEventsRequestEntry{
+		Source:     aws.String(event.AggregateType),
+		DetailType: aws.String(event.Type),
+		Detail:     aws.String(string(detail)),
+		Time:       aws.Time(event.Created),
+	}
+	if d.eventBusName != "" {
+		entry.EventBusName = aws.String(d.eventBusName)
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,193 @@
+package es_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/eventbridge"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/indebted-modules/es"
+	"github.com/stretchr/testify/suite"
+)
+
+type EventBridgeDriverSuite struct {
+	suite.Suite
+	eventBridgeSvc *eventbridge.EventBridge
+	sqsSvc         *sqs.SQS
+	queueURL       *string
+}
+
+func TestEventBridgeDriverSuite(t *testing.T) {
+	suite.Run(t, new(EventBridgeDriverSuite))
+}
+
+func (s *EventBridgeDriverSuite) SetupSuite() {
+	eventsEndpoint := "http://localstack:4587"
+	sqsEndpoint := "http://localstack:4576"
+	s.Eventually(func() bool {
+		_, err1 := http.Get(eventsEndpoint)
+		_, err2 := http.Get(sqsEndpoint)
+		return err1 == nil && err2 == nil
+	}, 10*time.Second, time.Second, "Localstack services are not ready or running")
+
+	sess := session.Must(session.NewSession())
+	cred := credentials.NewStaticCredentials("id", "secret", "token")
+	s.eventBridgeSvc = eventbridge.New(sess, aws.NewConfig().WithRegion("ap-southeast-2").WithCredentials(cred).WithEndpoint(eventsEndpoint))
+	s.sqsSvc = sqs.New(sess, aws.NewConfig().WithRegion("ap-southeast-2").WithCredentials(cred).WithEndpoint(sqsEndpoint))
+
+	queueResponse, err := s.sqsSvc.CreateQueue(&sqs.CreateQueueInput{QueueName: aws.String("test-eventbridge-queue")})
+	s.NoError(err)
+	s.queueURL = queueResponse.QueueUrl
+
+	attributes, err := s.sqsSvc.GetQueueAttributes(&sqs.GetQueueAttributesInput{
+		QueueUrl:       s.queueURL,
+		AttributeNames: []*string{aws.String("QueueArn")},
+	})
+	s.NoError(err)
+
+	_, err = s.eventBridgeSvc.PutRule(&eventbridge.PutRuleInput{
+		Name:         aws.String("test-rule"),
+		EventPattern: aws.String(`{"source": ["SampleAggregate", "AnotherSampleAggregate"]}`),
+	})
+	s.NoError(err)
+
+	_, err = s.eventBridgeSvc.PutTargets(&eventbridge.PutTargetsInput{
+		Rule: aws.String("test-rule"),
+		Targets: []*eventbridge.Target{
+			{
+				Id:  aws.String("test-target"),
+				Arn: attributes.Attributes["QueueArn"],
+			},
+		},
+	})
+	s.NoError(err)
+}
+
+func (s *EventBridgeDriverSuite) TearDownSuite() {
+	_, err := s.eventBridgeSvc.RemoveTargets(&eventbridge.RemoveTargetsInput{
+		Rule: aws.String("test-rule"),
+		Ids:  []*string{aws.String("test-target")},
+	})
+	s.NoError(err)
+	_, err = s.eventBridgeSvc.DeleteRule(&eventbridge.DeleteRuleInput{Name: aws.String("test-rule")})
+	s.NoError(err)
+	_, err = s.sqsSvc.DeleteQueue(&sqs.DeleteQueueInput{QueueUrl: s.queueURL})
+	s.NoError(err)
+}
+
+func (s *EventBridgeDriverSuite) TestDelegateLoadToInternalDriver() {
+	inMemoryDriver := es.NewInMemoryDriver()
+	err := inMemoryDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	driver := es.NewEventBridgeDriver(s.eventBridgeSvc, "", inMemoryDriver)
+
+	events, err := driver.Load("123")
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+}
+
+func (s *EventBridgeDriverSuite) TestSaveDoesNotPublishWhenBrokenDriver() {
+	brokenDriver := &BrokenDriver{ErrorMessage: "borked!"}
+	driver := es.NewEventBridgeDriver(s.eventBridgeSvc, "", brokenDriver)
+
+	err := driver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.Error(err, "borked!")
+
+	s.Empty(s.receiveMessages(1))
+}
+
+func (s *EventBridgeDriverSuite) TestSaveDoesNotPublishWhenNoEvents() {
+	driver := es.NewEventBridgeDriver(s.eventBridgeSvc, "", es.NewInMemoryDriver())
+
+	err := driver.Save([]*es.Event{})
+	s.NoError(err)
+
+	s.Empty(s.receiveMessages(1))
+}
+
+func (s *EventBridgeDriverSuite) TestPublishesEveryEventInBatches() {
+	events := []*es.Event{}
+	for i := 0; i < 12; i++ {
+		events = append(events, es.NewEvent(fmt.Sprintf("uuid-%d", i), &SomethingHappened{Data: fmt.Sprint(i)}))
+	}
+	events = append(events, es.NewEvent("uuid-12", &SomethingElseHappened{Data: "12"}))
+
+	driver := es.NewEventBridgeDriver(s.eventBridgeSvc, "", es.NewInMemoryDriver())
+	err := driver.Save(events)
+	s.NoError(err)
+
+	messages := s.receiveMessages(len(events))
+	s.Equal(len(events), len(messages))
+
+	received := map[string]string{}
+	for _, message := range messages {
+		body := &struct {
+			Source     string `json:"source"`
+			DetailType string `json:"detail-type"`
+			Detail     struct {
+				Data string
+			} `json:"detail"`
+		}{}
+		err = json.Unmarshal([]byte(*message.Body), body)
+		s.NoError(err)
+		received[body.Detail.Data] = body.Source + "/" + body.DetailType
+	}
+	s.Equal("SampleAggregate/SomethingHappened", received["0"])
+	s.Equal("SampleAggregate/SomethingHappened", received["11"])
+	s.Equal("AnotherSampleAggregate/SomethingElseHappened", received["12"])
+}
+
+func (s *EventBridgeDriverSuite) TestPublishesLargeEventsInBatchesUnderSizeLimit() {
+	events := []*es.Event{}
+	for i := 0; i < 3; i++ {
+		events = append(events, es.NewEvent(fmt.Sprintf("uuid-%d", i), &SomethingHappened{Data: strings.Repeat(fmt.Sprint(i), 100*1024)}))
+	}
+
+	driver := es.NewEventBridgeDriver(s.eventBridgeSvc, "", es.NewInMemoryDriver())
+	err := driver.Save(events)
+	s.NoError(err)
+
+	messages := s.receiveMessages(len(events))
+	s.Equal(len(events), len(messages))
+}
+
+func (s *EventBridgeDriverSuite) TestDelegateReadEventsOfTypesToInternalDriver() {
+	inMemoryDriver := es.NewInMemoryDriver()
+	err := inMemoryDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	driver := es.NewEventBridgeDriver(s.eventBridgeSvc, "", inMemoryDriver)
+
+	events, err := driver.ReadEventsOfTypes(0, 1, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+}
+
+func (s *EventBridgeDriverSuite) receiveMessages(expected int) []*sqs.Message {
+	messages := []*sqs.Message{}
+	for attempt := 0; attempt < 5 && len(messages) < expected; attempt++ {
+		response, err := s.sqsSvc.ReceiveMessage(&sqs.ReceiveMessageInput{
+			QueueUrl:            s.queueURL,
+			MaxNumberOfMessages: aws.Int64(10),
+			WaitTimeSeconds:     aws.Int64(1),
+		})
+		s.NoError(err)
+		for _, message := range response.Messages {
+			_, err = s.sqsSvc.DeleteMessage(&sqs.DeleteMessageInput{
+				QueueUrl:      s.queueURL,
+				ReceiptHandle: message.ReceiptHandle,
+			})
+			s.NoError(err)
+		}
+		messages = append(messages, response.Messages...)
+	}
+	return messages
+}
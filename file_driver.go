@@ -0,0 +1,666 @@
+package es
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrClosed is returned when using a FileDriver after closing it
+var ErrClosed = errors.New("file driver closed")
+
+// FileSyncPolicy tells when a FileDriver flushes segments to disk
+type FileSyncPolicy int
+
+const (
+	// SyncAlways flushes every save before returning, surviving power loss
+	SyncAlways FileSyncPolicy = iota
+	// SyncInterval flushes periodically, losing at most an interval of saves
+	// on power loss
+	SyncInterval
+	// SyncNever leaves flushing to the operating system, only surviving
+	// process crashes
+	SyncNever
+)
+
+// segmentExtension names the files holding the records of a FileDriver
+const segmentExtension = ".segment"
+
+// recordHeaderSize is the size of the length and checksum preceding every
+// record
+const recordHeaderSize = 8
+
+// FileOption configures a FileDriver
+type FileOption func(*FileDriver)
+
+// WithFileSync sets when segments are flushed to disk, the interval only
+// applying to `SyncInterval`. Defaults to `SyncAlways`.
+func WithFileSync(policy FileSyncPolicy, interval time.Duration) FileOption {
+	return func(d *FileDriver) {
+		d.policy = policy
+		d.interval = interval
+	}
+}
+
+// WithFileSegmentSize sets the size after which a new segment is started.
+// Defaults to 64MiB.
+func WithFileSegmentSize(bytes int64) FileOption {
+	return func(d *FileDriver) {
+		d.segmentSize = bytes
+	}
+}
+
+// WithFileClock sets the clock stamping saved events. Without it, events
+// created at no time are stamped by `SystemClock`.
+func WithFileClock(clock Clock) FileOption {
+	return func(d *FileDriver) {
+		d.clock = clock
+	}
+}
+
+// WithFileRegistry sets the registry decoding loaded events
+func WithFileRegistry(registry *Registry) FileOption {
+	return func(d *FileDriver) {
+		d.registry = registry
+	}
+}
+
+// WithFileTenancy requires a tenant on every load, save and read
+func WithFileTenancy() FileOption {
+	return func(d *FileDriver) {
+		d.multiTenant = true
+	}
+}
+
+// OpenFileDriver opens the segments in the given directory, creating it when
+// missing, and rebuilds the index from them. A record torn by a crash at the
+// end of the last segment, cut short, failing its checksum or zero-filled, is
+// truncated, while corruption anywhere else fails, leaving the segments
+// intact.
+func OpenFileDriver(dir string, options ...FileOption) (*FileDriver, error) {
+	d := &FileDriver{
+		dir:         dir,
+		policy:      SyncAlways,
+		interval:    time.Second,
+		segmentSize: 64 << 20,
+		streams:     map[string]*fileStream{},
+		done:        make(chan struct{}),
+	}
+	for _, option := range options {
+		option(d)
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.recover()
+	if err != nil {
+		d.closeSegments()
+		return nil, err
+	}
+
+	if d.policy == SyncInterval {
+		d.syncing.Add(1)
+		go d.syncPeriodically()
+	}
+	return d, nil
+}
+
+// FileDriver implements a durable event-store appending events to segment
+// files on local disk, for single-node tools and load testing. Every save is
+// appended as a single checksummed record, so that a save torn by a crash is
+// discarded as a whole on recovery. Positions and aggregate streams are
+// indexed in memory.
+type FileDriver struct {
+	dir         string
+	policy      FileSyncPolicy
+	interval    time.Duration
+	segmentSize int64
+	clock       Clock
+	registry    *Registry
+	multiTenant bool
+
+	mutex    sync.RWMutex
+	segments []*os.File
+	size     int64
+	log      []fileLocation
+	streams  map[string]*fileStream
+	dirty    bool
+	done     chan struct{}
+	syncing  sync.WaitGroup
+	closing  sync.Once
+}
+
+// fileLocation locates an event within the record of the save it belongs to
+type fileLocation struct {
+	segment int
+	offset  int64
+	index   int
+}
+
+type fileStream struct {
+	locations []fileLocation
+	versions  map[streamVersion]bool
+}
+
+// storedEvent is the JSON encoding of an event by drivers storing documents
+// rather than rows
+type storedEvent struct {
+	ID               int64
+	EventID          string `json:",omitempty"`
+	TenantID         string `json:",omitempty"`
+	Type             string
+	AggregateID      string
+	AggregateType    string
+	AggregateVersion int64
+	Created          time.Time
+	Payload          json.RawMessage
+}
+
+// Load loads all events by aggregate ID ordered by version
+func (d *FileDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext loads all events by aggregate ID ordered by version, scoped to
+// the context tenant
+func (d *FileDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.segments == nil {
+		return nil, ErrClosed
+	}
+
+	var events []*Event
+	stream, ok := d.streams[aggregateID]
+	if !ok {
+		return events, nil
+	}
+
+	registry := contextRegistry(ctx, d.registry)
+	batches := map[fileLocation][]*storedEvent{}
+	for _, location := range stream.locations {
+		record, err := d.readLocation(location, batches)
+		if err != nil {
+			return nil, err
+		}
+		if record.TenantID != tenantID {
+			continue
+		}
+
+		event, err := record.toEvent(registry)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].AggregateVersion < events[j].AggregateVersion
+	})
+	return events, nil
+}
+
+// Save appends all events to the active segment as a single record,
+// assigning their positions. If any of the events violates optimistic
+// locking, none of them is saved. Versions are unique per tenant and
+// aggregate.
+func (d *FileDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext saves all events like `Save`, stamping them with the context
+// tenant
+func (d *FileDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := stampTenant(ctx, events, d.multiTenant)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.segments == nil {
+		return ErrClosed
+	}
+
+	taken := map[string]map[streamVersion]bool{}
+	for _, event := range events {
+		version := streamVersion{TenantID: event.TenantID, Version: event.AggregateVersion}
+		if stream, ok := d.streams[event.AggregateID]; ok && stream.versions[version] {
+			return ErrOptimisticLocking
+		}
+		if taken[event.AggregateID][version] {
+			return ErrOptimisticLocking
+		}
+		if taken[event.AggregateID] == nil {
+			taken[event.AggregateID] = map[streamVersion]bool{}
+		}
+		taken[event.AggregateID][version] = true
+	}
+
+	clock := contextClock(ctx, d.clock)
+	records := make([]*storedEvent, 0, len(events))
+	for i, event := range events {
+		payload, err := event.marshalPayload()
+		if err != nil {
+			return err
+		}
+
+		records = append(records, &storedEvent{
+			ID:               int64(len(d.log) + i + 1),
+			EventID:          event.ID,
+			TenantID:         event.TenantID,
+			Type:             event.Type,
+			AggregateID:      event.AggregateID,
+			AggregateType:    event.AggregateType,
+			AggregateVersion: event.AggregateVersion,
+			Created:          createdAt(event, clock, SystemClock),
+			Payload:          payload,
+		})
+	}
+
+	data, err := encodeRecord(records)
+	if err != nil {
+		return err
+	}
+
+	if d.size > 0 && d.size+int64(len(data)) > d.segmentSize {
+		err = d.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	segment := len(d.segments) - 1
+	offset := d.size
+	err = d.append(data)
+	if err != nil {
+		return err
+	}
+
+	for i, record := range records {
+		d.index(record, fileLocation{segment: segment, offset: offset, index: i})
+		events[i].Position = record.ID
+		events[i].Created = record.Created
+	}
+	return nil
+}
+
+// ReadEventsOfTypes reads events of the given types after the given position
+func (d *FileDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext reads events of the given types after the given
+// position, scoped to the context tenant
+func (d *FileDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	typesMap := map[string]bool{}
+	for _, t := range types {
+		typesMap[t] = true
+	}
+
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.segments == nil {
+		return nil, ErrClosed
+	}
+
+	if position < 0 {
+		position = 0
+	}
+
+	events := []*Event{}
+	registry := contextRegistry(ctx, d.registry)
+	batches := map[fileLocation][]*storedEvent{}
+	for i := position; i < int64(len(d.log)) && uint(len(events)) < count; i++ {
+		record, err := d.readLocation(d.log[i], batches)
+		if err != nil {
+			return nil, err
+		}
+		if !typesMap[record.Type] || record.TenantID != tenantID {
+			continue
+		}
+
+		event, err := record.toEvent(registry)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// Close flushes and closes all segments, once
+func (d *FileDriver) Close() error {
+	var err error
+	d.closing.Do(func() {
+		err = d.close()
+	})
+	return err
+}
+
+func (d *FileDriver) close() error {
+	close(d.done)
+	d.syncing.Wait()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var err error
+	if d.policy != SyncNever && len(d.segments) > 0 {
+		err = d.segments[len(d.segments)-1].Sync()
+	}
+	d.closeSegments()
+	return err
+}
+
+// recover indexes every record of every segment, truncating a torn record
+// at the end of the last segment
+func (d *FileDriver) recover() error {
+	names, err := filepath.Glob(filepath.Join(d.dir, "*"+segmentExtension))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		file, err := os.OpenFile(name, os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		d.segments = append(d.segments, file)
+
+		size, torn, err := d.recoverSegment(i, file)
+		if err != nil {
+			if i < len(names)-1 || !torn {
+				return fmt.Errorf("corrupted segment '%s': %w", name, err)
+			}
+
+			log.
+				Warn().
+				Err(err).
+				Str("Segment", name).
+				Int64("Offset", size).
+				Msg("Truncating torn record")
+
+			err = file.Truncate(size)
+			if err != nil {
+				return err
+			}
+			err = file.Sync()
+			if err != nil {
+				return err
+			}
+		}
+		d.size = size
+	}
+
+	if len(d.segments) == 0 {
+		return d.rotate()
+	}
+	return nil
+}
+
+// recoverSegment indexes the records of the given segment, returning the
+// offset after the last valid one, and whether the invalid one, if any, was
+// torn at the end of the segment
+func (d *FileDriver) recoverSegment(segment int, file *os.File) (int64, bool, error) {
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var offset int64
+	for offset < int64(len(data)) {
+		records, size, err := decodeRecord(data[offset:])
+		if err != nil {
+			return offset, tornRecord(data[offset:]), err
+		}
+
+		for i, record := range records {
+			if record.ID != int64(len(d.log)+1) {
+				return offset, false, fmt.Errorf("unexpected position %d", record.ID)
+			}
+			d.index(record, fileLocation{segment: segment, offset: offset, index: i})
+		}
+		offset += size
+	}
+	return offset, false, nil
+}
+
+func (d *FileDriver) index(record *storedEvent, location fileLocation) {
+	d.log = append(d.log, location)
+
+	stream, ok := d.streams[record.AggregateID]
+	if !ok {
+		stream = &fileStream{versions: map[streamVersion]bool{}}
+		d.streams[record.AggregateID] = stream
+	}
+	stream.locations = append(stream.locations, location)
+	stream.versions[streamVersion{TenantID: record.TenantID, Version: record.AggregateVersion}] = true
+}
+
+// readLocation reads the event at the given location, decoding the record of
+// its save once per call through the given batches
+func (d *FileDriver) readLocation(location fileLocation, batches map[fileLocation][]*storedEvent) (*storedEvent, error) {
+	key := fileLocation{segment: location.segment, offset: location.offset}
+	records, ok := batches[key]
+	if !ok {
+		file := d.segments[location.segment]
+		header := make([]byte, recordHeaderSize)
+		_, err := file.ReadAt(header, location.offset)
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, recordHeaderSize+binary.BigEndian.Uint32(header))
+		_, err = file.ReadAt(data, location.offset)
+		if err != nil {
+			return nil, err
+		}
+
+		records, _, err = decodeRecord(data)
+		if err != nil {
+			return nil, err
+		}
+		batches[key] = records
+	}
+	return records[location.index], nil
+}
+
+// append writes the given record at the end of the active segment, undoing
+// partial writes
+func (d *FileDriver) append(data []byte) error {
+	file := d.segments[len(d.segments)-1]
+	_, err := file.WriteAt(data, d.size)
+	if err == nil && d.policy == SyncAlways {
+		err = file.Sync()
+	}
+	if err != nil {
+		tErr := file.Truncate(d.size)
+		if tErr != nil {
+			log.
+				Warn().
+				Err(tErr).
+				Msg("Failed truncating partial write")
+		}
+		return err
+	}
+
+	d.size += int64(len(data))
+	d.dirty = true
+	return nil
+}
+
+// rotate flushes the active segment and starts a new one
+func (d *FileDriver) rotate() error {
+	if len(d.segments) > 0 && d.policy != SyncNever {
+		err := d.segments[len(d.segments)-1].Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	name := filepath.Join(d.dir, fmt.Sprintf("%020d%s", len(d.segments)+1, segmentExtension))
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	d.segments = append(d.segments, file)
+	d.size = 0
+	return syncDir(d.dir)
+}
+
+func (d *FileDriver) syncPeriodically() {
+	defer d.syncing.Done()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		d.mutex.Lock()
+		if d.dirty {
+			err := d.segments[len(d.segments)-1].Sync()
+			if err != nil {
+				log.
+					Warn().
+					Err(err).
+					Msg("Failed syncing segment")
+			}
+			d.dirty = err != nil
+		}
+		d.mutex.Unlock()
+	}
+}
+
+func (d *FileDriver) closeSegments() {
+	for _, segment := range d.segments {
+		ShouldClose(segment)
+	}
+	d.segments = nil
+}
+
+// toEvent decodes the stored event with the given registry, or returns nil
+// when its type is unknown and skipped
+func (r *storedEvent) toEvent(registry *Registry) (*Event, error) {
+	event := &Event{
+		ID:               storedID(r.EventID, r.ID),
+		Position:         r.ID,
+		TenantID:         r.TenantID,
+		Type:             r.Type,
+		AggregateID:      r.AggregateID,
+		AggregateType:    r.AggregateType,
+		AggregateVersion: r.AggregateVersion,
+		Created:          r.Created,
+	}
+	keep, err := registry.decodeEvent(event, r.Payload)
+	if !keep {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// encodeRecord frames the given records with their length and CRC-32
+// checksum
+func encodeRecord(records []*storedEvent) ([]byte, error) {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, recordHeaderSize+len(body))
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.ChecksumIEEE(body))
+	copy(data[recordHeaderSize:], body)
+	return data, nil
+}
+
+// decodeRecord decodes the record at the start of the given data, returning
+// its size, or an error when it's torn or corrupted
+func decodeRecord(data []byte) ([]*storedEvent, int64, error) {
+	if len(data) < recordHeaderSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	length := int64(binary.BigEndian.Uint32(data[0:4]))
+	if int64(len(data)) < recordHeaderSize+length {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	body := data[recordHeaderSize : recordHeaderSize+length]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[4:8]) {
+		return nil, 0, fmt.Errorf("checksum mismatch")
+	}
+
+	var records []*storedEvent
+	err := json.Unmarshal(body, &records)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(records) == 0 {
+		return nil, 0, fmt.Errorf("empty record")
+	}
+	return records, recordHeaderSize + length, nil
+}
+
+// tornRecord tells whether the given data, failing to decode, was left by a
+// crash while appending: a record reaching the end of the data, or zeros
+// written ahead of it by the file system
+func tornRecord(data []byte) bool {
+	if len(data) < recordHeaderSize || len(bytes.Trim(data, "\x00")) == 0 {
+		return true
+	}
+
+	length := int64(binary.BigEndian.Uint32(data[0:4]))
+	return recordHeaderSize+length >= int64(len(data))
+}
+
+// syncDir flushes the directory entries, such as a created segment
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer ShouldClose(file)
+
+	return file.Sync()
+}
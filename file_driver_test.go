@@ -0,0 +1,326 @@
+package es_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type FileDriverSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestFileDriverSuite(t *testing.T) {
+	suite.Run(t, new(FileDriverSuite))
+}
+
+func (s *FileDriverSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "segments")
+	s.NoError(err)
+	s.dir = dir
+}
+
+func (s *FileDriverSuite) TearDownTest() {
+	err := os.RemoveAll(s.dir)
+	s.NoError(err)
+}
+
+func (s *FileDriverSuite) TestSaveAndLoadAcrossRestarts() {
+	driver := s.open()
+	events := []*es.Event{
+		s.event("1", 1, "1 - V1"),
+		s.event("2", 1, "2 - V1"),
+		s.event("1", 2, "1 - V2"),
+	}
+	err := driver.Save(events)
+	s.NoError(err)
+	s.Equal(int64(3), events[2].Position)
+	err = driver.Close()
+	s.NoError(err)
+
+	driver = s.open()
+	defer es.ShouldClose(driver)
+	loaded, err := driver.Load("1")
+	s.NoError(err)
+	s.Equal([]*es.Event{events[0], events[2]}, loaded)
+
+	err = driver.Save([]*es.Event{s.event("2", 2, "2 - V2")})
+	s.NoError(err)
+	loaded, err = driver.Load("2")
+	s.NoError(err)
+	s.Equal(2, len(loaded))
+	s.Equal(int64(4), loaded[1].Position, "Positions carry on after restart")
+}
+
+func (s *FileDriverSuite) TestSaveOptimisticLocking() {
+	driver := s.open()
+	defer es.ShouldClose(driver)
+	err := driver.Save([]*es.Event{s.event("1", 1, "1 - V1")})
+	s.NoError(err)
+
+	err = driver.Save([]*es.Event{s.event("2", 1, "2 - V1"), s.event("1", 1, "1 - V1")})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+	err = driver.Save([]*es.Event{s.event("2", 1, "2 - V1"), s.event("2", 1, "2 - V1")})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+
+	events, err := driver.Load("2")
+	s.NoError(err)
+	s.Empty(events, "Nothing saved on violation")
+}
+
+func (s *FileDriverSuite) TestReadEventsForward() {
+	driver := s.open()
+	defer es.ShouldClose(driver)
+	err := driver.Save([]*es.Event{
+		es.NewEvent("1", &SomethingHappened{Data: "1"}),
+		es.NewEvent("2", &SomethingElseHappened{Data: "2"}),
+		es.NewEvent("3", &SomethingHappened{Data: "3"}),
+	})
+	s.NoError(err)
+
+	events, err := driver.ReadEventsOfTypes(0, 2, []string{"SomethingHappened", "SomethingElseHappened"})
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(int64(1), events[0].Position)
+	s.Equal(int64(2), events[1].Position)
+
+	events, err = driver.ReadEventsOfTypes(1, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "3"}, events[0].Payload)
+
+	events, err = driver.ReadEventsOfTypes(3, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *FileDriverSuite) TestRotatesSegments() {
+	driver := s.open(es.WithFileSegmentSize(256))
+	for version := int64(1); version <= 6; version++ {
+		err := driver.Save([]*es.Event{s.event("1", version, "some data to fill segments")})
+		s.NoError(err)
+	}
+	err := driver.Close()
+	s.NoError(err)
+	s.True(len(s.segments()) > 2)
+
+	driver = s.open(es.WithFileSegmentSize(256))
+	defer es.ShouldClose(driver)
+	events, err := driver.Load("1")
+	s.NoError(err)
+	s.Equal(6, len(events))
+	events, err = driver.ReadEventsOfTypes(4, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(2, len(events))
+}
+
+func (s *FileDriverSuite) TestTruncatesTornWrites() {
+	driver := s.open()
+	err := driver.Save([]*es.Event{s.event("1", 1, "1 - V1")})
+	s.NoError(err)
+	err = driver.Save([]*es.Event{s.event("1", 2, "1 - V2"), s.event("1", 3, "1 - V3")})
+	s.NoError(err)
+	err = driver.Close()
+	s.NoError(err)
+
+	segment := s.segments()[0]
+	info, err := os.Stat(segment)
+	s.NoError(err)
+	err = os.Truncate(segment, info.Size()-5)
+	s.NoError(err)
+
+	driver = s.open()
+	events, err := driver.Load("1")
+	s.NoError(err)
+	s.Equal(1, len(events), "Torn save discarded as a whole")
+
+	err = driver.Save([]*es.Event{s.event("1", 2, "1 - V2 again")})
+	s.NoError(err)
+	err = driver.Close()
+	s.NoError(err)
+
+	driver = s.open()
+	defer es.ShouldClose(driver)
+	events, err = driver.Load("1")
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(&SomethingHappened{Data: "1 - V2 again"}, events[1].Payload)
+	s.Equal(int64(2), events[1].Position)
+}
+
+func (s *FileDriverSuite) TestTruncatesRecordsFailingChecksum() {
+	driver := s.open()
+	err := driver.Save([]*es.Event{s.event("1", 1, "1 - V1")})
+	s.NoError(err)
+	err = driver.Save([]*es.Event{s.event("1", 2, "1 - V2")})
+	s.NoError(err)
+	err = driver.Close()
+	s.NoError(err)
+
+	s.corruptLastByte(s.segments()[0])
+
+	driver = s.open()
+	defer es.ShouldClose(driver)
+	events, err := driver.Load("1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+}
+
+func (s *FileDriverSuite) TestTruncatesZeroFilledTails() {
+	driver := s.open()
+	err := driver.Save([]*es.Event{s.event("1", 1, "1 - V1")})
+	s.NoError(err)
+	err = driver.Close()
+	s.NoError(err)
+
+	segment := s.segments()[0]
+	file, err := os.OpenFile(segment, os.O_APPEND|os.O_WRONLY, 0644)
+	s.Require().NoError(err)
+	_, err = file.Write(make([]byte, 64))
+	s.NoError(err)
+	s.NoError(file.Close())
+
+	driver = s.open()
+	defer es.ShouldClose(driver)
+	events, err := driver.Load("1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+	err = driver.Save([]*es.Event{s.event("1", 2, "1 - V2")})
+	s.NoError(err)
+}
+
+func (s *FileDriverSuite) TestFailsOnCorruptionWithinSegment() {
+	driver := s.open()
+	for version := int64(1); version <= 3; version++ {
+		err := driver.Save([]*es.Event{s.event("1", version, "data")})
+		s.NoError(err)
+	}
+	err := driver.Close()
+	s.NoError(err)
+
+	segment := s.segments()[0]
+	data, err := ioutil.ReadFile(segment)
+	s.NoError(err)
+	data[9]++ // Within the first record, after its header
+	err = ioutil.WriteFile(segment, data, 0644)
+	s.NoError(err)
+
+	_, err = es.OpenFileDriver(s.dir)
+	s.Error(err)
+	s.Regexp("corrupted segment.*checksum mismatch", err.Error())
+	corrupted, err := ioutil.ReadFile(segment)
+	s.NoError(err)
+	s.Equal(data, corrupted, "Later records are not truncated")
+}
+
+func (s *FileDriverSuite) TestFailsOnceClosed() {
+	driver := s.open(es.WithFileSync(es.SyncInterval, time.Millisecond))
+	err := driver.Close()
+	s.NoError(err)
+	err = driver.Close()
+	s.NoError(err, "Closing twice")
+
+	_, err = driver.Load("1")
+	s.Equal(es.ErrClosed, err)
+	err = driver.Save([]*es.Event{s.event("1", 1, "1 - V1")})
+	s.Equal(es.ErrClosed, err)
+	_, err = driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.Equal(es.ErrClosed, err)
+}
+
+func (s *FileDriverSuite) TestFailsOnCorruptionBeforeLastSegment() {
+	driver := s.open(es.WithFileSegmentSize(64))
+	for version := int64(1); version <= 3; version++ {
+		err := driver.Save([]*es.Event{s.event("1", version, "data")})
+		s.NoError(err)
+	}
+	err := driver.Close()
+	s.NoError(err)
+
+	s.corruptLastByte(s.segments()[0])
+
+	_, err = es.OpenFileDriver(s.dir, es.WithFileSegmentSize(64))
+	s.Error(err)
+	s.Regexp("corrupted segment.*checksum mismatch", err.Error())
+}
+
+func (s *FileDriverSuite) TestSyncsPeriodically() {
+	driver := s.open(es.WithFileSync(es.SyncInterval, time.Millisecond))
+	err := driver.Save([]*es.Event{s.event("1", 1, "1 - V1")})
+	s.NoError(err)
+	time.Sleep(5 * time.Millisecond)
+	err = driver.Close()
+	s.NoError(err)
+
+	driver = s.open()
+	defer es.ShouldClose(driver)
+	events, err := driver.Load("1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+}
+
+func (s *FileDriverSuite) TestTenantIsolation() {
+	driver := s.open(es.WithFileTenancy())
+	defer es.ShouldClose(driver)
+	acme := es.WithTenant(context.Background(), "acme")
+	err := driver.SaveContext(acme, []*es.Event{s.event("1", 1, "acme")})
+	s.NoError(err)
+
+	events, err := driver.LoadContext(es.WithTenant(context.Background(), "globex"), "1")
+	s.NoError(err)
+	s.Empty(events)
+	events, err = driver.ReadEventsOfTypesContext(acme, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	_, err = driver.Load("1")
+	s.Equal(es.ErrTenantRequired, err)
+}
+
+func (s *FileDriverSuite) open(options ...es.FileOption) *es.FileDriver {
+	driver, err := es.OpenFileDriver(s.dir, options...)
+	s.Require().NoError(err)
+	return driver
+}
+
+func (s *FileDriverSuite) event(aggregateID string, version int64, data string) *es.Event {
+	event := es.NewEvent(aggregateID, &SomethingHappened{Data: data})
+	event.AggregateVersion = version
+	return event
+}
+
+func (s *FileDriverSuite) segments() []string {
+	segments, err := filepath.Glob(filepath.Join(s.dir, "*.segment"))
+	s.NoError(err)
+	return segments
+}
+
+func (s *FileDriverSuite) corruptLastByte(segment string) {
+	data, err := ioutil.ReadFile(segment)
+	s.NoError(err)
+	data[len(data)-2]++
+	err = ioutil.WriteFile(segment, data, 0644)
+	s.NoError(err)
+}
+
+func TestFileDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		dir, err := ioutil.TempDir("", "segments")
+		require.NoError(t, err)
+		driver, err := es.OpenFileDriver(dir)
+		require.NoError(t, err)
+		return driver, func() {
+			es.ShouldClose(driver)
+			_ = os.RemoveAll(dir)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package es_test
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/stretchr/testify/suite"
+)
+
+type IDSuite struct {
+	suite.Suite
+}
+
+func TestIDSuite(t *testing.T) {
+	suite.Run(t, new(IDSuite))
+}
+
+var uuidv7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func (s *IDSuite) TestUUIDv7Layout() {
+	clock := es.FixedClock(time.Date(2022, time.February, 22, 19, 22, 22, 0, time.UTC))
+	id := es.NewUUIDv7Generator(clock).NewID()
+	s.Regexp(uuidv7Pattern, id)
+	s.Equal("017f22e2-79b0", id[:13], "Timestamp in milliseconds")
+}
+
+func (s *IDSuite) TestUUIDv7IncreasesWithinMillisecond() {
+	clock := es.FixedClock(time.Date(2022, time.February, 22, 19, 22, 22, 0, time.UTC))
+	ids := es.NewUUIDv7Generator(clock)
+
+	var generated []string
+	for i := 0; i < 5000; i++ {
+		generated = append(generated, ids.NewID())
+	}
+	s.True(sort.StringsAreSorted(generated))
+	for _, id := range generated {
+		s.Regexp(uuidv7Pattern, id)
+	}
+	s.NotEqual(generated[0], generated[1])
+}
+
+func (s *IDSuite) TestUUIDv7FollowsClock() {
+	clock := es.NewStepClock(time.Date(2022, time.February, 22, 19, 22, 22, 0, time.UTC), -time.Millisecond)
+	ids := es.NewUUIDv7Generator(clock)
+
+	first := ids.NewID()
+	second := ids.NewID()
+	s.True(first < second, "Keeps increasing when the clock goes backwards")
+}
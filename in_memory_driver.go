@@ -1,143 +1,333 @@
 package es
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"math"
 	"sort"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+// InMemoryOption configures an InMemoryDriver
+type InMemoryOption func(*InMemoryDriver)
+
+// WithInMemoryTenancy requires a tenant on every load, save and read
+func WithInMemoryTenancy() InMemoryOption {
+	return func(s *InMemoryDriver) {
+		s.multiTenant = true
+	}
+}
+
+// WithInMemoryClock sets the clock stamping saved events. Without it, events
+// created at no time are stamped by one starting at 2000-01-01 and moving a
+// second forward per event.
+func WithInMemoryClock(clock Clock) InMemoryOption {
+	return func(s *InMemoryDriver) {
+		s.clock = clock
+	}
+}
+
+// WithInMemoryRegistry sets the registry decoding loaded events
+func WithInMemoryRegistry(registry *Registry) InMemoryOption {
+	return func(s *InMemoryDriver) {
+		s.registry = registry
+	}
+}
+
 // NewInMemoryDriver creates a new InMemoryDriver
-func NewInMemoryDriver() *InMemoryDriver {
-	return &InMemoryDriver{
-		sequence: 0,
-		stream:   map[string]map[int64]*record{},
-		clock:    time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+func NewInMemoryDriver(options ...InMemoryOption) *InMemoryDriver {
+	s := &InMemoryDriver{
+		streams:  map[string]*inMemoryStream{},
+		fallback: NewStepClock(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC), time.Second),
 	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
 }
 
-// InMemoryDriver implementation for unit testing
+// InMemoryDriver implementation for unit and integration testing, safe for
+// concurrent use. Events are appended to a log indexed by position, whose
+// slot is left empty once removed, and indexed per aggregate by version.
 type InMemoryDriver struct {
-	sequence int64
-	stream   map[string]map[int64]*record
-	clock    time.Time
+	mutex       sync.RWMutex
+	log         []*record
+	streams     map[string]*inMemoryStream
+	clock       Clock
+	fallback    Clock
+	registry    *Registry
+	multiTenant bool
+}
+
+// inMemoryStream holds the records of an aggregate ordered by version
+type inMemoryStream struct {
+	records  []*record
+	versions map[streamVersion]bool
+}
+
+// streamVersion identifies an event for optimistic locking. Streams are kept
+// per tenant, so tenants never take versions of each other's streams.
+type streamVersion struct {
+	TenantID string
+	Version  int64
 }
 
 // Load all events by aggregate ID
 func (s *InMemoryDriver) Load(aggregateID string) ([]*Event, error) {
-	records := s.stream[aggregateID]
+	return s.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext loads all events by aggregate ID, scoped to the context tenant
+func (s *InMemoryDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	return s.LoadAfter(ctx, aggregateID, math.MinInt64)
+}
+
+// LatestVersion returns the version of the latest event by aggregate ID,
+// scoped to the context tenant
+func (s *InMemoryDriver) LatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	tenantID, err := contextTenant(ctx, s.multiTenant)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stream, ok := s.streams[aggregateID]
+	if !ok {
+		return 0, nil
+	}
+	for i := len(stream.records) - 1; i >= 0; i-- {
+		if stream.records[i].TenantID == tenantID {
+			return stream.records[i].AggregateVersion, nil
+		}
+	}
+	return 0, nil
+}
+
+// LoadAfter loads events by aggregate ID with a version greater than the
+// given one, scoped to the context tenant
+func (s *InMemoryDriver) LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, s.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := contextRegistry(ctx, s.registry)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
 	var events []*Event
-	for _, record := range records {
-		event, err := record.toEvent()
+	stream, ok := s.streams[aggregateID]
+	if !ok {
+		return events, nil
+	}
+
+	records := stream.records
+	from := sort.Search(len(records), func(i int) bool {
+		return records[i].AggregateVersion > version
+	})
+	for _, record := range records[from:] {
+		if record.TenantID != tenantID {
+			continue
+		}
+
+		event, err := record.toEvent(registry)
 		if err != nil {
 			return nil, err
 		}
 
-		events = append(events, event)
+		if event != nil {
+			events = append(events, event)
+		}
 	}
 
-	sort.Slice(events, func(i, j int) bool {
-		return events[i].AggregateVersion < events[j].AggregateVersion
-	})
-
 	return events, nil
 }
 
 // Save all events in memory
 func (s *InMemoryDriver) Save(events []*Event) error {
-	newStream := map[string]map[int64]*record{}
-	newSequence := s.sequence
-	newClock := s.clock
-	deepCopy(s.stream, newStream)
+	return s.SaveContext(context.Background(), events)
+}
+
+// SaveContext saves all events in memory, stamping them with the context
+// tenant. If any of the events violates optimistic locking, none of them is
+// saved. Versions are unique per tenant and aggregate.
+func (s *InMemoryDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := stampTenant(ctx, events, s.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
+	taken := map[string]map[streamVersion]bool{}
 	for _, event := range events {
-		newSequence++
-		event.ID = strconv.FormatInt(newSequence, 10)
-		event.Created = newClock
-		newClock = newClock.Add(1 * time.Second)
+		version := streamVersion{TenantID: event.TenantID, Version: event.AggregateVersion}
+		if stream, ok := s.streams[event.AggregateID]; ok && stream.versions[version] {
+			return ErrOptimisticLocking
+		}
+		if taken[event.AggregateID][version] {
+			return ErrOptimisticLocking
+		}
+		if taken[event.AggregateID] == nil {
+			taken[event.AggregateID] = map[streamVersion]bool{}
+		}
+		taken[event.AggregateID][version] = true
+	}
 
-		r, err := toRecord(event)
+	clock := contextClock(ctx, s.clock)
+	records := make([]*record, 0, len(events))
+	created := make([]time.Time, 0, len(events))
+	for i, event := range events {
+		created = append(created, createdAt(event, clock, s.fallback))
+		r, err := toRecord(event, int64(len(s.log)+i+1), created[i])
 		if err != nil {
 			return err
 		}
+		records = append(records, r)
+	}
 
-		if _, ok := newStream[r.AggregateID]; !ok {
-			newStream[r.AggregateID] = map[int64]*record{}
-		}
+	for i, r := range records {
+		s.log = append(s.log, r)
+		s.index(r)
+		events[i].Position = r.Position
+		events[i].Created = created[i]
+	}
+	return nil
+}
 
-		if _, ok := newStream[r.AggregateID][r.AggregateVersion]; ok {
-			return fmt.Errorf("optmistic locking violation")
-		}
+// RemoveStream removes all events by aggregate ID, scoped to the context
+// tenant. Their positions are never reused.
+func (s *InMemoryDriver) RemoveStream(ctx context.Context, aggregateID string) error {
+	tenantID, err := contextTenant(ctx, s.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-		newStream[r.AggregateID][r.AggregateVersion] = r
+	stream, ok := s.streams[aggregateID]
+	if !ok {
+		return nil
 	}
 
-	deepCopy(newStream, s.stream)
-	s.sequence = newSequence
-	s.clock = newClock
+	kept := stream.records[:0]
+	for _, r := range stream.records {
+		if r.TenantID != tenantID {
+			kept = append(kept, r)
+			continue
+		}
+		s.log[r.Position-1] = nil
+		delete(stream.versions, streamVersion{TenantID: r.TenantID, Version: r.AggregateVersion})
+	}
+	stream.records = kept
+	if len(kept) == 0 {
+		delete(s.streams, aggregateID)
+	}
 	return nil
 }
 
-// ReadEventsOfTypes .
+// ReadEventsOfTypes reads events of the given types after the given position
 func (s *InMemoryDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return s.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext reads events of the given types after the given
+// position, scoped to the context tenant
+func (s *InMemoryDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, s.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
 	typesMap := map[string]bool{}
 	for _, t := range types {
 		typesMap[t] = true
 	}
 
-	filteredStream := []*Event{}
-	for _, event := range s.Stream()[position:] {
-		if typesMap[event.Type] {
-			filteredStream = append(filteredStream, event)
-		}
-	}
+	registry := contextRegistry(ctx, s.registry)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	limit := math.Min(float64(len(filteredStream)), float64(count))
-	return filteredStream[:int64(limit)], nil
-}
+	if position < 0 {
+		position = 0
+	}
+	events := []*Event{}
+	for i := position; i < int64(len(s.log)) && uint(len(events)) < count; i++ {
+		r := s.log[i]
+		if r == nil || !typesMap[r.Type] || r.TenantID != tenantID {
+			continue
+		}
 
-func deepCopy(source, destination map[string]map[int64]*record) {
-	for aggregateID, records := range source {
-		for version, r := range records {
-			if _, ok := destination[aggregateID]; !ok {
-				destination[aggregateID] = map[int64]*record{}
-			}
-			destination[aggregateID][version] = r
+		event, err := r.toEvent(registry)
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			events = append(events, event)
 		}
 	}
+
+	return events, nil
 }
 
-// Stream all events
+// Stream all events ordered by position
 func (s *InMemoryDriver) Stream() []*Event {
+	registry := contextRegistry(context.Background(), s.registry)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
 	var events []*Event
-	for _, records := range s.stream {
-		for _, record := range records {
-			event, err := record.toEvent()
-			if err != nil {
-				log.
-					Fatal().
-					Err(err).
-					Msg("Failed reading in-memory stream")
-			}
+	for _, record := range s.log {
+		if record == nil {
+			continue
+		}
 
+		event, err := record.toEvent(registry)
+		if err != nil {
+			log.
+				Fatal().
+				Err(err).
+				Msg("Failed reading in-memory stream")
+		}
+
+		if event != nil {
 			events = append(events, event)
 		}
 	}
 
-	sort.Slice(events, func(i, j int) bool {
-		return events[i].ID < events[j].ID
-	})
-
 	return events
 }
 
+// index adds the given record to the stream of its aggregate, keeping it
+// ordered by version
+func (s *InMemoryDriver) index(r *record) {
+	stream, ok := s.streams[r.AggregateID]
+	if !ok {
+		stream = &inMemoryStream{versions: map[streamVersion]bool{}}
+		s.streams[r.AggregateID] = stream
+	}
+	stream.versions[streamVersion{TenantID: r.TenantID, Version: r.AggregateVersion}] = true
+
+	// Versions are mostly saved in order, making this an append
+	at := sort.Search(len(stream.records), func(i int) bool {
+		return stream.records[i].AggregateVersion > r.AggregateVersion
+	})
+	stream.records = append(stream.records, nil)
+	copy(stream.records[at+1:], stream.records[at:])
+	stream.records[at] = r
+}
+
 type record struct {
+	Position         int64
 	ID               string
+	TenantID         string
 	Type             string
 	AggregateID      string
 	AggregateType    string
@@ -146,51 +336,53 @@ type record struct {
 	Created          string
 }
 
-func (r *record) toEvent() (*Event, error) {
-	payload, err := resolveType(r.Type)
-	if err != nil {
-		return nil, err
-	}
-	err = json.Unmarshal([]byte(r.Payload), payload)
-	if err != nil {
-		return nil, err
-	}
-
+// toEvent decodes the record with the given registry, or returns nil when
+// its type is unknown and skipped
+func (r *record) toEvent(registry *Registry) (*Event, error) {
 	var created time.Time
-	err = json.Unmarshal([]byte(r.Created), &created)
+	err := json.Unmarshal([]byte(r.Created), &created)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Event{
-		ID:               r.ID,
+	event := &Event{
+		ID:               storedID(r.ID, r.Position),
+		Position:         r.Position,
+		TenantID:         r.TenantID,
 		Type:             r.Type,
 		AggregateID:      r.AggregateID,
 		AggregateType:    r.AggregateType,
 		AggregateVersion: r.AggregateVersion,
-		Payload:          payload,
 		Created:          created,
-	}, nil
+	}
+	keep, err := registry.decodeEvent(event, []byte(r.Payload))
+	if !keep {
+		return nil, err
+	}
+
+	return event, nil
 }
 
-func toRecord(e *Event) (*record, error) {
-	payload, err := json.Marshal(e.Payload)
+func toRecord(e *Event, position int64, created time.Time) (*record, error) {
+	payload, err := e.marshalPayload()
 	if err != nil {
 		return nil, err
 	}
 
-	created, err := json.Marshal(e.Created)
+	createdJSON, err := json.Marshal(created)
 	if err != nil {
 		return nil, err
 	}
 
 	return &record{
+		Position:         position,
 		ID:               e.ID,
+		TenantID:         e.TenantID,
 		Type:             e.Type,
 		AggregateID:      e.AggregateID,
 		AggregateType:    e.AggregateType,
 		AggregateVersion: e.AggregateVersion,
 		Payload:          string(payload),
-		Created:          string(created),
+		Created:          string(createdJSON),
 	}, nil
 }
@@ -1,10 +1,15 @@
 package es_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -18,18 +23,21 @@ func TestInMemoryDriverSuite(t *testing.T) {
 
 func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	driver := es.NewInMemoryDriver()
-	err := driver.Save([]*es.Event{
-		es.NewEvent("uuid-1", &SomethingHappened{Data: "1"}),
-		es.NewEvent("uuid-2", &SomethingHappened{Data: "2"}),
-		es.NewEvent("uuid-3", &SomethingElseHappened{Data: "3"}),
-	})
+	clock := es.WithEventClock(es.NewStepClock(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC), time.Second))
+	saved := []*es.Event{
+		es.NewEvent("uuid-1", &SomethingHappened{Data: "1"}, clock),
+		es.NewEvent("uuid-2", &SomethingHappened{Data: "2"}, clock),
+		es.NewEvent("uuid-3", &SomethingElseHappened{Data: "3"}, clock),
+	}
+	err := driver.Save(saved)
 	s.NoError(err)
 
 	events, err := driver.ReadEventsOfTypes(0, 1, []string{"SomethingHappened", "SomethingElseHappened"})
 	s.NoError(err)
 	s.Equal([]*es.Event{
 		{
-			ID:               "1",
+			ID:               saved[0].ID,
+			Position:         1,
 			Type:             "SomethingHappened",
 			AggregateID:      "uuid-1",
 			AggregateType:    "SampleAggregate",
@@ -43,7 +51,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	s.NoError(err)
 	s.Equal([]*es.Event{
 		{
-			ID:               "2",
+			ID:               saved[1].ID,
+			Position:         2,
 			Type:             "SomethingHappened",
 			AggregateID:      "uuid-2",
 			AggregateType:    "SampleAggregate",
@@ -57,7 +66,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	s.NoError(err)
 	s.Equal([]*es.Event{
 		{
-			ID:               "3",
+			ID:               saved[2].ID,
+			Position:         3,
 			Type:             "SomethingElseHappened",
 			AggregateID:      "uuid-3",
 			AggregateType:    "AnotherSampleAggregate",
@@ -75,7 +85,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	s.NoError(err)
 	s.Equal([]*es.Event{
 		{
-			ID:               "1",
+			ID:               saved[0].ID,
+			Position:         1,
 			Type:             "SomethingHappened",
 			AggregateID:      "uuid-1",
 			AggregateType:    "SampleAggregate",
@@ -84,7 +95,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 			Created:          time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
 		},
 		{
-			ID:               "2",
+			ID:               saved[1].ID,
+			Position:         2,
 			Type:             "SomethingHappened",
 			AggregateID:      "uuid-2",
 			AggregateType:    "SampleAggregate",
@@ -98,7 +110,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	s.NoError(err)
 	s.Equal([]*es.Event{
 		{
-			ID:               "2",
+			ID:               saved[1].ID,
+			Position:         2,
 			Type:             "SomethingHappened",
 			AggregateID:      "uuid-2",
 			AggregateType:    "SampleAggregate",
@@ -107,7 +120,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 			Created:          time.Date(2000, time.January, 1, 0, 0, 1, 0, time.UTC),
 		},
 		{
-			ID:               "3",
+			ID:               saved[2].ID,
+			Position:         3,
 			Type:             "SomethingElseHappened",
 			AggregateID:      "uuid-3",
 			AggregateType:    "AnotherSampleAggregate",
@@ -121,7 +135,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	s.NoError(err)
 	s.Equal([]*es.Event{
 		{
-			ID:               "3",
+			ID:               saved[2].ID,
+			Position:         3,
 			Type:             "SomethingElseHappened",
 			AggregateID:      "uuid-3",
 			AggregateType:    "AnotherSampleAggregate",
@@ -135,7 +150,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	s.NoError(err)
 	s.Equal([]*es.Event{
 		{
-			ID:               "1",
+			ID:               saved[0].ID,
+			Position:         1,
 			Type:             "SomethingHappened",
 			AggregateID:      "uuid-1",
 			AggregateType:    "SampleAggregate",
@@ -144,7 +160,8 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 			Created:          time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
 		},
 		{
-			ID:               "2",
+			ID:               saved[1].ID,
+			Position:         2,
 			Type:             "SomethingHappened",
 			AggregateID:      "uuid-2",
 			AggregateType:    "SampleAggregate",
@@ -162,3 +179,160 @@ func (s *InMemoryDriverSuite) TestReadEventsForward() {
 	s.NoError(err)
 	s.Empty(events, "Returns no events when there are no events for that type")
 }
+
+func (s *InMemoryDriverSuite) TestSaveOptimisticLocking() {
+	driver := es.NewInMemoryDriver()
+	err := driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{Data: "1"})})
+	s.NoError(err)
+
+	err = driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{Data: "1"})})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+}
+
+func (s *InMemoryDriverSuite) TestTenantIsolation() {
+	driver := es.NewInMemoryDriver(es.WithInMemoryTenancy())
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+	err := driver.SaveContext(acme, []*es.Event{es.NewEvent("uuid-1", &SomethingHappened{Data: "acme"})})
+	s.NoError(err)
+	globexEvent := es.NewEvent("uuid-2", &SomethingHappened{Data: "globex"})
+	globexEvent.TenantID = "globex"
+	err = driver.Save([]*es.Event{globexEvent})
+	s.NoError(err, "Tenant set explicitly")
+
+	events, err := driver.LoadContext(acme, "uuid-1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("acme", events[0].TenantID)
+	events, err = driver.LoadContext(globex, "uuid-1")
+	s.NoError(err)
+	s.Empty(events)
+
+	events, err = driver.ReadEventsOfTypesContext(globex, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "globex"}, events[0].Payload)
+
+	_, err = driver.Load("uuid-1")
+	s.Equal(es.ErrTenantRequired, err)
+	_, err = driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.Equal(es.ErrTenantRequired, err)
+	err = driver.Save([]*es.Event{es.NewEvent("uuid-3", &SomethingHappened{})})
+	s.Equal(es.ErrTenantRequired, err)
+	err = driver.SaveContext(acme, []*es.Event{globexEvent})
+	s.Equal(es.ErrTenantMismatch, err)
+}
+
+func (s *InMemoryDriverSuite) TestOrdersByNumericPosition() {
+	driver := es.NewInMemoryDriver()
+	for i := 1; i <= 12; i++ {
+		err := driver.Save([]*es.Event{es.NewEvent(fmt.Sprintf("uuid-%d", i), &SomethingHappened{Data: fmt.Sprint(i)})})
+		s.NoError(err)
+	}
+
+	stream := driver.Stream()
+	s.Equal(12, len(stream))
+	for i, event := range stream {
+		s.Equal(int64(i+1), event.Position)
+	}
+
+	events, err := driver.ReadEventsOfTypes(9, 2, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(int64(10), events[0].Position)
+	s.Equal(int64(11), events[1].Position)
+}
+
+func (s *InMemoryDriverSuite) TestSaveIsAtomic() {
+	driver := es.NewInMemoryDriver(es.WithInMemoryClock(es.NewStepClock(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC), time.Second)))
+	err := driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{})})
+	s.NoError(err)
+
+	err = driver.Save([]*es.Event{es.NewEvent("uuid-2", &SomethingHappened{}), es.NewEvent("uuid-1", &SomethingHappened{})})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+	err = driver.Save([]*es.Event{es.NewEvent("uuid-2", &SomethingHappened{}), es.NewEvent("uuid-2", &SomethingHappened{})})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+	s.Equal(1, len(driver.Stream()))
+
+	event := es.NewEvent("uuid-2", &SomethingHappened{})
+	err = driver.Save([]*es.Event{event})
+	s.NoError(err)
+	s.Equal(int64(2), event.Position)
+	s.Equal(time.Date(2000, time.January, 1, 0, 0, 1, 0, time.UTC), event.Created)
+}
+
+func (s *InMemoryDriverSuite) TestLoadsOrderedByVersion() {
+	driver := es.NewInMemoryDriver()
+	for _, version := range []int64{2, 3, 1} {
+		event := es.NewEvent("uuid-1", &SomethingHappened{Data: fmt.Sprint(version)})
+		event.AggregateVersion = version
+		err := driver.Save([]*es.Event{event})
+		s.NoError(err)
+	}
+
+	events, err := driver.Load("uuid-1")
+	s.NoError(err)
+	s.Equal(3, len(events))
+	s.Equal(int64(1), events[0].AggregateVersion)
+	s.Equal(int64(3), events[2].AggregateVersion)
+
+	events, err = driver.LoadAfter(context.Background(), "uuid-1", 1)
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(&SomethingHappened{Data: "2"}, events[0].Payload)
+}
+
+func (s *InMemoryDriverSuite) TestRemoveStreamKeepsPositions() {
+	driver := es.NewInMemoryDriver()
+	err := driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{}), es.NewEvent("uuid-2", &SomethingHappened{})})
+	s.NoError(err)
+
+	err = driver.RemoveStream(context.Background(), "uuid-1")
+	s.NoError(err)
+	events, err := driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(int64(2), events[0].Position)
+
+	event := es.NewEvent("uuid-1", &SomethingHappened{})
+	err = driver.Save([]*es.Event{event})
+	s.NoError(err)
+	s.Equal(int64(3), event.Position)
+}
+
+func (s *InMemoryDriverSuite) TestDecodesWithRegistry() {
+	driver := es.NewInMemoryDriver(es.WithInMemoryRegistry(privateRegistry()))
+	err := driver.Save([]*es.Event{es.NewEvent("AggregateID#1", &SomethingPrivateHappened{Data: "private"})})
+	s.NoError(err)
+
+	events, err := driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal(&SomethingPrivateHappened{Data: "private"}, events[0].Payload)
+
+	_, err = driver.LoadContext(es.WithRegistry(context.Background(), es.NewRegistry()), "AggregateID#1")
+	s.Error(err, "Context registry takes precedence")
+}
+
+func (s *InMemoryDriverSuite) TestConcurrentSaves() {
+	driver := es.NewInMemoryDriver()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_ = driver.Save([]*es.Event{es.NewEvent(fmt.Sprintf("uuid-%d", i), &SomethingHappened{})})
+			_, _ = driver.ReadEventsOfTypes(0, 100, []string{"SomethingHappened"})
+		}(i)
+	}
+	wg.Wait()
+
+	events, err := driver.ReadEventsOfTypes(0, 100, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(20, len(events))
+}
+
+func TestInMemoryDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		return es.NewInMemoryDriver(), nil
+	})
+}
@@ -0,0 +1,142 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NewMetricsDriver creates a new MetricsDriver
+func NewMetricsDriver(driver Driver) *MetricsDriver {
+	return &MetricsDriver{
+		Driver: driver,
+		savedEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "es",
+			Name:      "saved_events_total",
+			Help:      "Number of events saved, by event and aggregate type.",
+		}, []string{"event_type", "aggregate_type"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "es",
+			Name:      "driver_duration_seconds",
+			Help:      "Duration of driver operations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "es",
+			Name:      "driver_errors_total",
+			Help:      "Number of failed driver operations, optimistic locking conflicts excluded.",
+		}, []string{"operation"}),
+		conflicts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "es",
+			Name:      "optimistic_locking_conflicts_total",
+			Help:      "Number of saves rejected by optimistic locking.",
+		}),
+		streamLengths: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "es",
+			Name:      "loaded_stream_length",
+			Help:      "Number of events loaded per aggregate.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+	}
+}
+
+// MetricsDriver implementation recording Prometheus metrics about the
+// internal driver. It's a `prometheus.Collector`, meant to be registered
+// with the registry exposing the application metrics.
+type MetricsDriver struct {
+	Driver        Driver
+	savedEvents   *prometheus.CounterVec
+	durations     *prometheus.HistogramVec
+	errors        *prometheus.CounterVec
+	conflicts     prometheus.Counter
+	streamLengths prometheus.Histogram
+}
+
+// Load delegates to internal driver and records its duration and the
+// length of the loaded stream
+func (d *MetricsDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (d *MetricsDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	start := time.Now()
+	events, err := loadContext(ctx, d.Driver, aggregateID)
+	d.observe("Load", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	d.streamLengths.Observe(float64(len(events)))
+	return events, nil
+}
+
+// Save delegates to internal driver and counts saved events
+func (d *MetricsDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (d *MetricsDriver) SaveContext(ctx context.Context, events []*Event) error {
+	start := time.Now()
+	err := saveContext(ctx, d.Driver, events)
+	d.observe("Save", start, err)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		d.savedEvents.WithLabelValues(event.Type, event.AggregateType).Inc()
+	}
+	return nil
+}
+
+// ReadEventsOfTypes delegates to internal driver and records its duration
+func (d *MetricsDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *MetricsDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	start := time.Now()
+	events, err := readEventsOfTypesContext(ctx, d.Driver, position, count, types)
+	d.observe("ReadEventsOfTypes", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Describe implements `prometheus.Collector`
+func (d *MetricsDriver) Describe(ch chan<- *prometheus.Desc) {
+	d.savedEvents.Describe(ch)
+	d.durations.Describe(ch)
+	d.errors.Describe(ch)
+	d.conflicts.Describe(ch)
+	d.streamLengths.Describe(ch)
+}
+
+// Collect implements `prometheus.Collector`
+func (d *MetricsDriver) Collect(ch chan<- prometheus.Metric) {
+	d.savedEvents.Collect(ch)
+	d.durations.Collect(ch)
+	d.errors.Collect(ch)
+	d.conflicts.Collect(ch)
+	d.streamLengths.Collect(ch)
+}
+
+func (d *MetricsDriver) observe(operation string, start time.Time, err error) {
+	d.durations.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, ErrOptimisticLocking) {
+		d.conflicts.Inc()
+		return
+	}
+	d.errors.WithLabelValues(operation).Inc()
+}
@@ -0,0 +1,165 @@
+package es_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsDriverSuite struct {
+	suite.Suite
+}
+
+func TestMetricsDriverSuite(t *testing.T) {
+	suite.Run(t, new(MetricsDriverSuite))
+}
+
+func (s *MetricsDriverSuite) TestDelegateLoadToInternalDriver() {
+	driver := es.NewInMemoryDriver()
+	err := driver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	metricsDriver := es.NewMetricsDriver(driver)
+	events, err := metricsDriver.Load("123")
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+}
+
+func (s *MetricsDriverSuite) TestDelegateReadEventsOfTypesToInternalDriver() {
+	driver := es.NewInMemoryDriver()
+	err := driver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	metricsDriver := es.NewMetricsDriver(driver)
+	events, err := metricsDriver.ReadEventsOfTypes(0, 1, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+}
+
+func (s *MetricsDriverSuite) TestRegistersWithPrometheusRegistry() {
+	registry := prometheus.NewRegistry()
+	err := registry.Register(es.NewMetricsDriver(es.NewInMemoryDriver()))
+	s.NoError(err)
+}
+
+func (s *MetricsDriverSuite) TestCountsSavedEventsByType() {
+	metricsDriver := es.NewMetricsDriver(es.NewInMemoryDriver())
+	err := metricsDriver.Save([]*es.Event{
+		s.evtVersion(es.NewEvent("1", &SomethingHappened{}), 1),
+		s.evtVersion(es.NewEvent("1", &SomethingHappened{}), 2),
+		s.evtVersion(es.NewEvent("2", &SomethingElseHappened{}), 1),
+	})
+	s.NoError(err)
+
+	err = testutil.CollectAndCompare(metricsDriver, strings.NewReader(`
+		# HELP es_saved_events_total Number of events saved, by event and aggregate type.
+		# TYPE es_saved_events_total counter
+		es_saved_events_total{aggregate_type="AnotherSampleAggregate",event_type="SomethingElseHappened"} 1
+		es_saved_events_total{aggregate_type="SampleAggregate",event_type="SomethingHappened"} 2
+	`), "es_saved_events_total")
+	s.NoError(err)
+}
+
+func (s *MetricsDriverSuite) TestTimesOperations() {
+	metricsDriver := es.NewMetricsDriver(es.NewInMemoryDriver())
+	err := metricsDriver.Save([]*es.Event{es.NewEvent("1", &SomethingHappened{})})
+	s.NoError(err)
+	_, err = metricsDriver.Load("1")
+	s.NoError(err)
+	_, err = metricsDriver.Load("1")
+	s.NoError(err)
+	_, err = metricsDriver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+
+	histograms := s.gather(metricsDriver, "es_driver_duration_seconds")
+	counts := map[string]uint64{}
+	for _, metric := range histograms {
+		counts[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+	}
+	s.Equal(map[string]uint64{
+		"Load":              2,
+		"Save":              1,
+		"ReadEventsOfTypes": 1,
+	}, counts)
+}
+
+func (s *MetricsDriverSuite) TestTracksLoadedStreamLengths() {
+	metricsDriver := es.NewMetricsDriver(es.NewInMemoryDriver())
+	err := metricsDriver.Save([]*es.Event{
+		s.evtVersion(es.NewEvent("1", &SomethingHappened{}), 1),
+		s.evtVersion(es.NewEvent("1", &SomethingHappened{}), 2),
+		s.evtVersion(es.NewEvent("1", &SomethingHappened{}), 3),
+	})
+	s.NoError(err)
+	_, err = metricsDriver.Load("1")
+	s.NoError(err)
+
+	histograms := s.gather(metricsDriver, "es_loaded_stream_length")
+	s.Equal(1, len(histograms))
+	s.Equal(uint64(1), histograms[0].GetHistogram().GetSampleCount())
+	s.Equal(float64(3), histograms[0].GetHistogram().GetSampleSum())
+}
+
+func (s *MetricsDriverSuite) TestCountsOptimisticLockingConflictsApartFromErrors() {
+	metricsDriver := es.NewMetricsDriver(es.NewInMemoryDriver())
+	err := metricsDriver.Save([]*es.Event{es.NewEvent("1", &SomethingHappened{})})
+	s.NoError(err)
+	err = metricsDriver.Save([]*es.Event{es.NewEvent("1", &SomethingHappened{})})
+	s.Error(err)
+
+	conflicts := s.gather(metricsDriver, "es_optimistic_locking_conflicts_total")
+	s.Equal(float64(1), conflicts[0].GetCounter().GetValue())
+	s.Empty(s.gather(metricsDriver, "es_driver_errors_total"))
+}
+
+func (s *MetricsDriverSuite) TestCountsErrorsByOperation() {
+	metricsDriver := es.NewMetricsDriver(&BrokenDriver{ErrorMessage: "borked!"})
+	_, err := metricsDriver.Load("1")
+	s.Error(err)
+	err = metricsDriver.Save([]*es.Event{})
+	s.Error(err)
+	err = metricsDriver.Save([]*es.Event{})
+	s.Error(err)
+
+	err = testutil.CollectAndCompare(metricsDriver, strings.NewReader(`
+		# HELP es_driver_errors_total Number of failed driver operations, optimistic locking conflicts excluded.
+		# TYPE es_driver_errors_total counter
+		es_driver_errors_total{operation="Load"} 1
+		es_driver_errors_total{operation="Save"} 2
+	`), "es_driver_errors_total")
+	s.NoError(err)
+
+	conflicts := s.gather(metricsDriver, "es_optimistic_locking_conflicts_total")
+	s.Equal(float64(0), conflicts[0].GetCounter().GetValue())
+}
+
+func (s *MetricsDriverSuite) gather(collector prometheus.Collector, name string) []*dto.Metric {
+	registry := prometheus.NewPedanticRegistry()
+	s.NoError(registry.Register(collector))
+
+	families, err := registry.Gather()
+	s.NoError(err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()
+		}
+	}
+	return nil
+}
+
+func (s *MetricsDriverSuite) evtVersion(event *es.Event, version int64) *es.Event {
+	event.AggregateVersion = version
+	return event
+}
+
+func TestMetricsDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		return es.NewMetricsDriver(es.NewInMemoryDriver()), nil
+	})
+}
@@ -0,0 +1,419 @@
+package es
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/rs/zerolog/log"
+)
+
+const createMySQLTable = `
+	CREATE TABLE events (
+		ID               BIGINT AUTO_INCREMENT PRIMARY KEY,
+		EventID          VARCHAR(255) DEFAULT '' NOT NULL,
+		TenantID         VARCHAR(255) DEFAULT '' NOT NULL,
+		Type             VARCHAR(255) NOT NULL,
+		Created          DATETIME(6) NOT NULL,
+		AggregateID      CHAR(36) NOT NULL,
+		AggregateVersion INT NOT NULL,
+		AggregateType    VARCHAR(255) NOT NULL,
+		Payload          JSON NOT NULL,
+
+		CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion, TenantID),
+		INDEX EventsTenant (TenantID, ID)
+	) ENGINE = InnoDB
+`
+
+const addMySQLTenantColumn = `
+	ALTER TABLE events
+		ADD COLUMN TenantID VARCHAR(255) DEFAULT '' NOT NULL AFTER ID,
+		DROP INDEX OptimisticLocking,
+		ADD CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion, TenantID),
+		ADD INDEX EventsTenant (TenantID, ID)
+`
+
+const addMySQLEventIDColumn = `
+	ALTER TABLE events ADD COLUMN EventID VARCHAR(255) DEFAULT '' NOT NULL AFTER ID
+`
+
+// convertMySQLCreatedColumn converts creation times kept as TIMESTAMP by
+// earlier versions to DATETIME, which MySQL does in the session time zone
+const convertMySQLCreatedColumn = `
+	ALTER TABLE events MODIFY COLUMN Created DATETIME(6) NOT NULL
+`
+
+// mysqlDatetime formats times the way DATETIME columns parse them
+const mysqlDatetime = "2006-01-02 15:04:05.999999"
+
+// duplicateEntry is the MySQL error number raised when a unique constraint
+// is violated
+const duplicateEntry = 1062
+
+// MySQLOption configures a MySQLDriver
+type MySQLOption func(*MySQLDriver)
+
+// WithMySQLTenancy requires a tenant on every load, save and read
+func WithMySQLTenancy() MySQLOption {
+	return func(d *MySQLDriver) {
+		d.multiTenant = true
+	}
+}
+
+// WithMySQLClock sets the clock stamping saved events. Without it, events
+// created at no time are stamped by MySQL.
+func WithMySQLClock(clock Clock) MySQLOption {
+	return func(d *MySQLDriver) {
+		d.clock = clock
+	}
+}
+
+// WithMySQLRegistry sets the registry decoding loaded events
+func WithMySQLRegistry(registry *Registry) MySQLOption {
+	return func(d *MySQLDriver) {
+		d.registry = registry
+	}
+}
+
+// NewMySQLDriver creates a MySQLDriver on the given database
+func NewMySQLDriver(db *sql.DB, options ...MySQLOption) *MySQLDriver {
+	d := &MySQLDriver{DB: db}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// MySQLDriver implements a MySQL-backed event-store behaving like
+// `PostgresDriver`. Creation times are kept in UTC, so `DB` must parse them
+// as such, as opened by `MustConnectMySQL`.
+type MySQLDriver struct {
+	DB          *sql.DB
+	multiTenant bool
+	clock       Clock
+	registry    *Registry
+}
+
+// CreateTable creates the event-store table with the necessary columns and
+// constraints
+func (d *MySQLDriver) CreateTable() error {
+	_, err := d.DB.Exec(createMySQLTable)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Migrate creates the event-store table when missing, or adds the columns
+// it lacks and converts creation times to UTC DATETIME when created by an
+// earlier version
+func (d *MySQLDriver) Migrate() error {
+	_, err := d.DB.Exec(strings.Replace(createMySQLTable, "CREATE TABLE", "CREATE TABLE IF NOT EXISTS", 1))
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range []struct {
+		column string
+		alter  string
+	}{
+		{column: "TenantID", alter: addMySQLTenantColumn},
+		{column: "EventID", alter: addMySQLEventIDColumn},
+	} {
+		var columns int
+		err = d.DB.QueryRow(`
+			SELECT COUNT(*)
+			FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'events' AND COLUMN_NAME = ?
+		`, migration.column).Scan(&columns)
+		if err != nil {
+			return err
+		}
+		if columns > 0 {
+			continue
+		}
+
+		_, err = d.DB.Exec(migration.alter)
+		if err != nil {
+			return err
+		}
+	}
+
+	var dataType string
+	err = d.DB.QueryRow(`
+		SELECT DATA_TYPE
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'events' AND COLUMN_NAME = 'Created'
+	`).Scan(&dataType)
+	if err != nil {
+		return err
+	}
+	if dataType != "timestamp" {
+		return nil
+	}
+
+	// TIMESTAMP values are converted from the session time zone
+	ctx := context.Background()
+	conn, err := d.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer ShouldClose(conn)
+	_, err = conn.ExecContext(ctx, `SET time_zone = '+00:00'`)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, convertMySQLCreatedColumn)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Load loads all events for the given aggregateID ordered by version
+func (d *MySQLDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext loads all events for the given aggregateID ordered by version,
+// scoped to the context tenant
+func (d *MySQLDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryEvents(ctx, selectEvents+`
+		WHERE AggregateID = ? AND TenantID = ?
+		ORDER BY AggregateVersion
+	`, aggregateID, tenantID)
+}
+
+// LatestVersion returns the version of the latest event for the given
+// aggregateID, or zero when there are none, scoped to the context tenant
+func (d *MySQLDriver) LatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	err = d.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(AggregateVersion), 0)
+		FROM events
+		WHERE AggregateID = ? AND TenantID = ?
+	`, aggregateID, tenantID).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// LoadAfter loads the events for the given aggregateID with a version greater
+// than the given one, ordered by version and scoped to the context tenant
+func (d *MySQLDriver) LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryEvents(ctx, selectEvents+`
+		WHERE AggregateID = ? AND AggregateVersion > ? AND TenantID = ?
+		ORDER BY AggregateVersion
+	`, aggregateID, version, tenantID)
+}
+
+// Save saves all given events in the underlying event-store table. It does so
+// in a transactional manner, meaning that if any of the events violates any
+// constraints, none of the events will be persisted.
+func (d *MySQLDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext saves all given events like `Save`, stamping them with the
+// context tenant
+func (d *MySQLDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := stampTenant(ctx, events, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	clock := contextClock(ctx, d.clock)
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO events (
+			EventID,
+			TenantID,
+			Type,
+			AggregateID,
+			AggregateVersion,
+			AggregateType,
+			Payload,
+			Created
+		) VALUES(?, ?, ?, ?, ?, ?, ?, COALESCE(?, UTC_TIMESTAMP(6)))
+	`)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+	defer ShouldClose(stmt)
+
+	positions := make([]int64, len(events))
+	for i, event := range events {
+		payload, err := event.marshalPayload()
+		if err != nil {
+			rollback(tx)
+			return err
+		}
+
+		// Without a clock or a creation time, the database tells the time
+		var created interface{}
+		if t := createdAt(event, clock, nil); !t.IsZero() {
+			created = t.UTC().Format(mysqlDatetime)
+		}
+
+		result, err := stmt.ExecContext(
+			ctx,
+			event.ID,
+			event.TenantID,
+			event.Type,
+			event.AggregateID,
+			event.AggregateVersion,
+			event.AggregateType,
+			string(payload), // JSON columns reject binary strings
+			created,
+		)
+		if err != nil {
+			rollback(tx)
+			var mysqlErr *mysql.MySQLError
+			if errors.As(err, &mysqlErr) && mysqlErr.Number == duplicateEntry && strings.Contains(mysqlErr.Message, "OptimisticLocking") {
+				return &conflictError{err: err}
+			}
+			return err
+		}
+		positions[i], err = result.LastInsertId()
+		if err != nil {
+			rollback(tx)
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for i, event := range events {
+		event.Position = positions[i]
+	}
+	return nil
+}
+
+// RemoveStream deletes all events for the given aggregateID, scoped to the
+// context tenant
+func (d *MySQLDriver) RemoveStream(ctx context.Context, aggregateID string) error {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.DB.ExecContext(ctx, `
+		DELETE FROM events
+		WHERE AggregateID = ? AND TenantID = ?
+	`, aggregateID, tenantID)
+	return err
+}
+
+// ReadEventsOfTypes .
+func (d *MySQLDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext reads events of the given types after the given
+// position, scoped to the context tenant
+func (d *MySQLDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+	types = contextRegistry(ctx, d.registry).readTypes(types)
+	if len(types) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{position}
+	for _, t := range types {
+		args = append(args, t)
+	}
+	args = append(args, tenantID, count)
+
+	return d.queryEvents(ctx, selectEvents+`
+		WHERE ID > ? AND
+		Type IN (?`+strings.Repeat(", ?", len(types)-1)+`) AND
+		TenantID = ?
+		ORDER BY ID
+		LIMIT ?
+	`, args...)
+}
+
+func (d *MySQLDriver) queryEvents(ctx context.Context, query string, args ...interface{}) ([]*Event, error) {
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer ShouldClose(rows)
+
+	events, err := rowsToEvents(rows, contextRegistry(ctx, d.registry))
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// MustConnectMySQL ensures a healthy connection is established with the
+// given DSN, parsing timestamps as UTC. Panics otherwise.
+func MustConnectMySQL(dsn string) *sql.DB {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		log.
+			Fatal().
+			Err(err).
+			Msg("Failed parsing MySQL DSN")
+	}
+	config.ParseTime = true
+	config.Loc = time.UTC
+	if config.Params == nil {
+		config.Params = map[string]string{}
+	}
+	config.Params["time_zone"] = "'+00:00'"
+
+	db, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		log.
+			Fatal().
+			Err(err).
+			Msg("Failed opening connection to the database")
+	}
+	err = db.Ping()
+	if err != nil {
+		log.
+			Fatal().
+			Err(err).
+			Msg("Failed sending ping to the database")
+	}
+	db.SetConnMaxLifetime(time.Hour)
+	db.SetMaxIdleConns(1)
+	db.SetMaxOpenConns(1)
+	return db
+}
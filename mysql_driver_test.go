@@ -0,0 +1,444 @@
+package es_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MySQLDriverSuite struct {
+	suite.Suite
+	db     *sql.DB
+	driver *es.MySQLDriver
+}
+
+func TestMySQLDriverSuite(t *testing.T) {
+	suite.Run(t, new(MySQLDriverSuite))
+}
+
+func (s *MySQLDriverSuite) SetupTest() {
+	s.db = es.MustConnectMySQL(os.Getenv("MYSQL_URL"))
+
+	s.driver = es.NewMySQLDriver(s.db, es.WithMySQLClock(es.FixedClock(time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC))))
+	err := s.driver.CreateTable()
+	s.NoError(err)
+}
+
+func (s *MySQLDriverSuite) TearDownTest() {
+	_, err := s.db.Exec(`DROP TABLE IF EXISTS events`)
+	s.NoError(err)
+	err = s.db.Close()
+	s.NoError(err)
+}
+
+func (s *MySQLDriverSuite) TestLoad() {
+	s.insert(1, "SomethingHappened", phonyUUID(1), 0, "AggregateType", `{"Data": "AggregateID#1 - V0"}`)
+	s.insert(2, "SomethingHappened", phonyUUID(2), 0, "AggregateType", `{"Data": "AggregateID#2 - V0"}`)
+	s.insert(3, "SomethingHappened", phonyUUID(1), 1, "AggregateType", `{"Data": "AggregateID#1 - V1"}`)
+
+	events, err := s.driver.Load(phonyUUID(1))
+	s.NoError(err)
+	s.Equal([]*es.Event{
+		{
+			ID:               "1",
+			Type:             "SomethingHappened",
+			Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V0"},
+		},
+		{
+			ID:               "3",
+			Type:             "SomethingHappened",
+			Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V1"},
+		},
+	}, events)
+
+	events, err = s.driver.Load(phonyUUID(2))
+	s.NoError(err)
+	s.Equal([]*es.Event{
+		{
+			ID:               "2",
+			Type:             "SomethingHappened",
+			Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+			AggregateID:      phonyUUID(2),
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#2 - V0"},
+		},
+	}, events)
+}
+
+func (s *MySQLDriverSuite) TestLatestVersionAndLoadAfter() {
+	err := s.driver.Save([]*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V1"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 2,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V2"},
+		},
+	})
+	s.NoError(err)
+
+	version, err := s.driver.LatestVersion(context.Background(), phonyUUID(1))
+	s.NoError(err)
+	s.Equal(int64(2), version)
+
+	version, err = s.driver.LatestVersion(context.Background(), phonyUUID(2))
+	s.NoError(err)
+	s.Equal(int64(0), version)
+
+	events, err := s.driver.LoadAfter(context.Background(), phonyUUID(1), 1)
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "AggregateID#1 - V2"}, events[0].Payload)
+
+	events, err = s.driver.LoadAfter(context.Background(), phonyUUID(1), 2)
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *MySQLDriverSuite) TestTenantIsolation() {
+	mysqlDriver := es.NewMySQLDriver(s.db, es.WithMySQLTenancy())
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+
+	err := mysqlDriver.SaveContext(acme, []*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "acme"},
+		},
+	})
+	s.NoError(err)
+
+	events, err := mysqlDriver.LoadContext(acme, phonyUUID(1))
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("acme", events[0].TenantID)
+	events, err = mysqlDriver.LoadContext(globex, phonyUUID(1))
+	s.NoError(err)
+	s.Empty(events)
+	events, err = mysqlDriver.ReadEventsOfTypesContext(globex, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events)
+
+	_, err = mysqlDriver.Load(phonyUUID(1))
+	s.Equal(es.ErrTenantRequired, err)
+}
+
+func (s *MySQLDriverSuite) TestSave() {
+	events := []*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V0"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V1"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(2),
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#2 - V0"},
+		},
+	}
+
+	err := s.driver.Save(events)
+	s.NoError(err)
+
+	rows, err := s.db.Query(`
+		SELECT
+			ID,
+			Type,
+			Created,
+			AggregateID,
+			AggregateVersion,
+			AggregateType,
+			Payload
+		FROM events
+		ORDER BY ID
+	`)
+	s.NoError(err)
+	result, err := readResult(rows)
+	s.NoError(err)
+
+	s.Equal([]*Row{
+		{
+			ID:               1,
+			Type:             "SomethingHappened",
+			Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          []byte(`{"Data": "AggregateID#1 - V0"}`),
+		},
+		{
+			ID:               2,
+			Type:             "SomethingHappened",
+			Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          []byte(`{"Data": "AggregateID#1 - V1"}`),
+		},
+		{
+			ID:               3,
+			Type:             "SomethingHappened",
+			Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+			AggregateID:      phonyUUID(2),
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          []byte(`{"Data": "AggregateID#2 - V0"}`),
+		},
+	}, result)
+}
+
+func (s *MySQLDriverSuite) TestSaveOptimisticLocking() {
+	events := []*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V0"},
+		},
+	}
+
+	err := s.driver.Save(events)
+	s.NoError(err)
+
+	err = s.driver.Save(events)
+	s.Error(err)
+	s.Regexp(".*Duplicate entry.*", err.Error())
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+}
+
+func (s *MySQLDriverSuite) TestSaveInTransaction() {
+	events := []*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      "AggregateID#1 - TX",
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - TX"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      "AggregateID#1 - TX",
+			AggregateVersion: 0,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - TX"},
+		},
+	}
+
+	err := s.driver.Save(events)
+	s.Error(err)
+
+	var count int
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count)
+	s.NoError(err)
+	s.Equal(0, count)
+}
+
+func (s *MySQLDriverSuite) TestSaveEmptyEvents() {
+	err := s.driver.Save([]*es.Event{})
+	s.NoError(err)
+}
+
+func (s *MySQLDriverSuite) TestReadEventsForward() {
+	s.insert(1, "SomethingHappened", phonyUUID(1), 0, "SampleAggregate", `{"Data": "1"}`)
+	s.insert(2, "SomethingHappened", phonyUUID(2), 0, "SampleAggregate", `{"Data": "2"}`)
+	s.insert(3, "SomethingElseHappened", phonyUUID(3), 0, "AnotherSampleAggregate", `{"Data": "3"}`)
+
+	first := &es.Event{
+		ID:               "1",
+		Type:             "SomethingHappened",
+		AggregateID:      phonyUUID(1),
+		AggregateType:    "SampleAggregate",
+		AggregateVersion: 0,
+		Payload:          &SomethingHappened{Data: "1"},
+		Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+	}
+	second := &es.Event{
+		ID:               "2",
+		Type:             "SomethingHappened",
+		AggregateID:      phonyUUID(2),
+		AggregateType:    "SampleAggregate",
+		AggregateVersion: 0,
+		Payload:          &SomethingHappened{Data: "2"},
+		Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+	}
+	third := &es.Event{
+		ID:               "3",
+		Type:             "SomethingElseHappened",
+		AggregateID:      phonyUUID(3),
+		AggregateType:    "AnotherSampleAggregate",
+		AggregateVersion: 0,
+		Payload:          &SomethingElseHappened{Data: "3"},
+		Created:          time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC),
+	}
+	bothTypes := []string{"SomethingHappened", "SomethingElseHappened"}
+
+	events, err := s.driver.ReadEventsOfTypes(0, 1, bothTypes)
+	s.NoError(err)
+	s.Equal([]*es.Event{first}, events)
+
+	events, err = s.driver.ReadEventsOfTypes(1, 1, bothTypes)
+	s.NoError(err)
+	s.Equal([]*es.Event{second}, events)
+
+	events, err = s.driver.ReadEventsOfTypes(2, 1, bothTypes)
+	s.NoError(err)
+	s.Equal([]*es.Event{third}, events)
+
+	events, err = s.driver.ReadEventsOfTypes(3, 1, bothTypes)
+	s.NoError(err)
+	s.Empty(events)
+
+	events, err = s.driver.ReadEventsOfTypes(0, 2, bothTypes)
+	s.NoError(err)
+	s.Equal([]*es.Event{first, second}, events)
+
+	events, err = s.driver.ReadEventsOfTypes(1, 10, bothTypes)
+	s.NoError(err)
+	s.Equal([]*es.Event{second, third}, events)
+
+	events, err = s.driver.ReadEventsOfTypes(0, 1, []string{"SomethingElseHappened"})
+	s.NoError(err)
+	s.Equal([]*es.Event{third}, events)
+
+	events, err = s.driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal([]*es.Event{first, second}, events)
+
+	events, err = s.driver.ReadEventsOfTypes(0, 10, []string{})
+	s.NoError(err)
+	s.Empty(events, "Returns no events when type list is empty")
+
+	events, err = s.driver.ReadEventsOfTypes(0, 10, []string{"SomethingUnknownHappened"})
+	s.NoError(err)
+	s.Empty(events, "Returns no events when there are no events for that type")
+}
+
+func (s *MySQLDriverSuite) TestStoresCreationTimesInUTC() {
+	created := time.Date(1985, time.October, 26, 11, 22, 0, 0, time.FixedZone("AEST", 10*60*60))
+	driver := es.NewMySQLDriver(s.db, es.WithMySQLClock(es.FixedClock(created)))
+	err := driver.Save([]*es.Event{es.NewEvent(phonyUUID(1), &SomethingHappened{})})
+	s.NoError(err)
+
+	var stored string
+	err = s.db.QueryRow(`SELECT DATE_FORMAT(Created, '%Y-%m-%d %H:%i:%s') FROM events`).Scan(&stored)
+	s.NoError(err)
+	s.Equal("1985-10-26 01:22:00", stored)
+
+	events, err := driver.Load(phonyUUID(1))
+	s.NoError(err)
+	s.Equal(created.UTC(), events[0].Created)
+}
+
+func (s *MySQLDriverSuite) TestMigrate() {
+	_, err := s.db.Exec(`
+		ALTER TABLE events
+			DROP INDEX EventsTenant,
+			DROP INDEX OptimisticLocking,
+			DROP COLUMN TenantID,
+			DROP COLUMN EventID,
+			MODIFY COLUMN Created TIMESTAMP(6) DEFAULT CURRENT_TIMESTAMP(6) NOT NULL,
+			ADD CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion)
+	`)
+	s.NoError(err)
+	s.insert(1, "SomethingHappened", phonyUUID(1), 0, "SampleAggregate", `{"Data": "1"}`)
+
+	err = s.driver.Migrate()
+	s.NoError(err)
+	err = s.driver.Migrate()
+	s.NoError(err, "Migrating is idempotent")
+
+	events, err := s.driver.Load(phonyUUID(1))
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("", events[0].TenantID)
+	s.Equal("1", events[0].ID, "Existing events are loaded with their positions as IDs")
+	s.Equal(time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC), events[0].Created, "Creation times are kept")
+	var dataType string
+	err = s.db.QueryRow(`
+		SELECT DATA_TYPE
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'events' AND COLUMN_NAME = 'Created'
+	`).Scan(&dataType)
+	s.NoError(err)
+	s.Equal("datetime", dataType)
+
+	event := es.NewEvent(phonyUUID(1), &SomethingHappened{})
+	event.AggregateVersion = 0
+	err = s.driver.SaveContext(es.WithTenant(context.Background(), "acme"), []*es.Event{event})
+	s.NoError(err, "Versions are unique per tenant")
+
+	_, err = s.db.Exec(`DROP TABLE events`)
+	s.NoError(err)
+	err = s.driver.Migrate()
+	s.NoError(err)
+	err = s.driver.Save([]*es.Event{es.NewEvent(phonyUUID(1), &SomethingHappened{})})
+	s.NoError(err, "Creates missing table")
+}
+
+func (s *MySQLDriverSuite) insert(id int64, typ string, aggregateID string, version int64, aggregateType string, payload string) {
+	_, err := s.db.Exec(`
+		INSERT INTO events (
+			ID,
+			Type,
+			Created,
+			AggregateID,
+			AggregateVersion,
+			AggregateType,
+			Payload
+		) VALUES(?, ?, ?, ?, ?, ?, ?)
+	`, id, typ, time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC), aggregateID, version, aggregateType, payload)
+	s.NoError(err)
+}
+
+func TestMySQLDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		db := es.MustConnectMySQL(os.Getenv("MYSQL_URL"))
+		driver := &es.MySQLDriver{DB: db}
+		require.NoError(t, driver.CreateTable())
+		return driver, func() {
+			_, err := db.Exec(`DROP TABLE IF EXISTS events`)
+			assert.NoError(t, err)
+			es.ShouldClose(db)
+		}
+	})
+}
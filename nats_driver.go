@@ -0,0 +1,355 @@
+package es
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+// natsSubjectPrefix is the root of every subject events are published on
+const natsSubjectPrefix = "es"
+
+// NATSOption configures a NATSDriver
+type NATSOption func(*NATSDriver)
+
+// WithNATSAckTimeout sets how long saves wait for the acknowledgements of
+// their publications. Defaults to 5 seconds.
+func WithNATSAckTimeout(timeout time.Duration) NATSOption {
+	return func(d *NATSDriver) {
+		d.ackTimeout = timeout
+	}
+}
+
+// NewNATSDriver creates a NATSDriver
+func NewNATSDriver(js nats.JetStreamContext, driver Driver, options ...NATSOption) *NATSDriver {
+	d := &NATSDriver{
+		js:         js,
+		driver:     driver,
+		ackTimeout: 5 * time.Second,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// NATSDriver creates a driver decorator that publishes every saved event to
+// NATS JetStream on the `es.<AggregateType>.<Type>` subject. The event ID is
+// used as `Nats-Msg-Id`, letting the server discard duplicated publications.
+type NATSDriver struct {
+	js         nats.JetStreamContext
+	driver     Driver
+	ackTimeout time.Duration
+}
+
+type natsMessage struct {
+	ID               string
+	TenantID         string `json:",omitempty"`
+	Type             string
+	AggregateID      string
+	AggregateType    string
+	AggregateVersion int64
+	Created          time.Time
+	Payload          json.RawMessage
+}
+
+// CreateStream creates the JetStream stream capturing all subjects events
+// are published on.
+func (d *NATSDriver) CreateStream(name string) error {
+	_, err := d.js.AddStream(&nats.StreamConfig{
+		Name:     name,
+		Subjects: []string{natsSubjectPrefix + ".>"},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Load delegates to internal driver
+func (d *NATSDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (d *NATSDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	return loadContext(ctx, d.driver, aggregateID)
+}
+
+// Save delegates to internal driver. If successful, it'll publish every event
+// asynchronously and wait for all acknowledgements, until the ack timeout
+// expires or the context is done. Failed publications are logged.
+func (d *NATSDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (d *NATSDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := saveContext(ctx, d.driver, events)
+	if err != nil {
+		return err
+	}
+
+	futures := []nats.PubAckFuture{}
+	for _, event := range events {
+		data, err := toNATSMessage(event)
+		if err != nil {
+			log.
+				Warn().
+				Err(err).
+				Str("EventID", event.ID).
+				Str("EventType", event.Type).
+				Msg("Failed marshaling NATS message")
+
+			continue
+		}
+
+		future, err := d.js.PublishMsgAsync(&nats.Msg{
+			Subject: NATSSubject(event.AggregateType, event.Type),
+			Data:    data,
+		}, nats.MsgId(event.ID))
+		if err != nil {
+			log.
+				Warn().
+				Err(err).
+				Str("EventID", event.ID).
+				Str("EventType", event.Type).
+				Msg("Failed publishing to NATS")
+
+			continue
+		}
+		futures = append(futures, future)
+	}
+
+	timeout := time.NewTimer(d.ackTimeout)
+	defer timeout.Stop()
+	for i, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			log.
+				Warn().
+				Err(err).
+				Str("Subject", future.Msg().Subject).
+				Msg("Failed publishing to NATS")
+		case <-timeout.C:
+			log.
+				Warn().
+				Int("Pending", len(futures)-i).
+				Msg("Timed out waiting for NATS acknowledgements")
+
+			return nil
+		case <-ctx.Done():
+			log.
+				Warn().
+				Err(ctx.Err()).
+				Int("Pending", len(futures)-i).
+				Msg("Stopped waiting for NATS acknowledgements")
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// ReadEventsOfTypes .
+func (d *NATSDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *NATSDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	return readEventsOfTypesContext(ctx, d.driver, position, count, types)
+}
+
+// NATSSubject returns the subject events of the given aggregate and event
+// types are published on. Both types are escaped, for separators, wildcards
+// and whitespace not to split or widen the subject.
+func NATSSubject(aggregateType string, typ string) string {
+	return strings.Join([]string{natsSubjectPrefix, natsToken(aggregateType), natsToken(typ)}, ".")
+}
+
+// natsToken percent-encodes what isn't allowed in a subject token
+func natsToken(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' || c == '*' || c == '>' || c == '%' || c <= ' ' || c == 0x7f:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// EventHandler handles events delivered by a subscriber
+type EventHandler func(event *Event) error
+
+// NATSSubscriberOption configures a NATSSubscriber
+type NATSSubscriberOption func(*NATSSubscriber)
+
+// WithNATSRegistry sets the registry decoding delivered events. Defaults to
+// `DefaultRegistry`.
+func WithNATSRegistry(registry *Registry) NATSSubscriberOption {
+	return func(s *NATSSubscriber) {
+		s.registry = registry
+	}
+}
+
+// NewNATSSubscriber creates a NATSSubscriber
+func NewNATSSubscriber(js nats.JetStreamContext, durable string, options ...NATSSubscriberOption) *NATSSubscriber {
+	s := &NATSSubscriber{
+		js:       js,
+		durable:  durable,
+		handlers: map[string]EventHandler{},
+		registry: DefaultRegistry,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// NATSSubscriber feeds events published by the NATSDriver to typed handlers
+// through a durable JetStream consumer. Messages are acknowledged once their
+// handler succeeds and redelivered otherwise. Handlers may be registered
+// while subscribed.
+type NATSSubscriber struct {
+	js       nats.JetStreamContext
+	durable  string
+	mutex    sync.RWMutex
+	handlers map[string]EventHandler
+	registry *Registry
+}
+
+// Handle registers the handler for events of the given payload type
+func (s *NATSSubscriber) Handle(payload EventPayload, handler EventHandler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers[payload.PayloadType()] = handler
+}
+
+// handler returns the handler registered for the given event type, if any
+func (s *NATSSubscriber) handler(eventType string) (EventHandler, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	handler, ok := s.handlers[eventType]
+	return handler, ok
+}
+
+// Subscribe starts consuming events with the durable consumer
+func (s *NATSSubscriber) Subscribe() (*nats.Subscription, error) {
+	return s.js.Subscribe(
+		natsSubjectPrefix+".>",
+		s.dispatch,
+		nats.Durable(s.durable),
+		nats.DeliverAll(),
+		nats.AckExplicit(),
+		nats.ManualAck(),
+	)
+}
+
+func (s *NATSSubscriber) dispatch(msg *nats.Msg) {
+	event, err := fromNATSMessage(msg.Data, s.registry)
+	if err != nil {
+		log.
+			Warn().
+			Err(err).
+			Str("Subject", msg.Subject).
+			Msg("Failed decoding NATS message")
+
+		s.settle(msg.Term())
+		return
+	}
+
+	if event == nil {
+		s.settle(msg.Ack())
+		return
+	}
+
+	handler, ok := s.handler(event.Type)
+	if !ok {
+		s.settle(msg.Ack())
+		return
+	}
+
+	err = handler(event)
+	if err != nil {
+		log.
+			Warn().
+			Err(err).
+			Str("EventID", event.ID).
+			Str("EventType", event.Type).
+			Msg("Failed handling event")
+
+		s.settle(msg.Nak())
+		return
+	}
+
+	s.settle(msg.Ack())
+}
+
+func (s *NATSSubscriber) settle(err error) {
+	if err != nil {
+		log.
+			Warn().
+			Err(err).
+			Msg("Failed acknowledging NATS message")
+	}
+}
+
+func toNATSMessage(event *Event) ([]byte, error) {
+	payload, err := event.marshalPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(&natsMessage{
+		ID:               event.ID,
+		TenantID:         event.TenantID,
+		Type:             event.Type,
+		AggregateID:      event.AggregateID,
+		AggregateType:    event.AggregateType,
+		AggregateVersion: event.AggregateVersion,
+		Created:          event.Created,
+		Payload:          payload,
+	})
+}
+
+// fromNATSMessage decodes the given message with the given registry, or
+// returns nil when its type is unknown and skipped
+func fromNATSMessage(data []byte, registry *Registry) (*Event, error) {
+	var message natsMessage
+	err := json.Unmarshal(data, &message)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &Event{
+		ID:               message.ID,
+		TenantID:         message.TenantID,
+		Type:             message.Type,
+		AggregateID:      message.AggregateID,
+		AggregateType:    message.AggregateType,
+		AggregateVersion: message.AggregateVersion,
+		Created:          message.Created,
+	}
+	keep, err := registry.decodeEvent(event, message.Payload)
+	if !keep {
+		return nil, err
+	}
+
+	return event, nil
+}
@@ -0,0 +1,260 @@
+package es_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/suite"
+)
+
+type NATSDriverSuite struct {
+	suite.Suite
+	storeDir string
+	server   *server.Server
+	conn     *nats.Conn
+	js       nats.JetStreamContext
+}
+
+func TestNATSDriverSuite(t *testing.T) {
+	suite.Run(t, new(NATSDriverSuite))
+}
+
+func (s *NATSDriverSuite) SetupTest() {
+	storeDir, err := ioutil.TempDir("", "nats")
+	s.Require().NoError(err)
+	s.storeDir = storeDir
+
+	s.server, err = server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  storeDir,
+	})
+	s.Require().NoError(err)
+	go s.server.Start()
+	s.Require().True(s.server.ReadyForConnections(5*time.Second), "NATS server is not ready")
+
+	s.conn, err = nats.Connect(s.server.ClientURL())
+	s.Require().NoError(err)
+	s.js, err = s.conn.JetStream()
+	s.Require().NoError(err)
+
+	err = es.NewNATSDriver(s.js, es.NewInMemoryDriver()).CreateStream("events")
+	s.Require().NoError(err)
+}
+
+func (s *NATSDriverSuite) TearDownTest() {
+	s.conn.Close()
+	s.server.Shutdown()
+	err := os.RemoveAll(s.storeDir)
+	s.NoError(err)
+}
+
+func (s *NATSDriverSuite) TestDelegateLoadToInternalDriver() {
+	inMemoryDriver := es.NewInMemoryDriver()
+	err := inMemoryDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	driver := es.NewNATSDriver(s.js, inMemoryDriver)
+
+	events, err := driver.Load("123")
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+}
+
+func (s *NATSDriverSuite) TestSaveDoesNotPublishWhenBrokenDriver() {
+	driver := es.NewNATSDriver(s.js, &BrokenDriver{ErrorMessage: "borked!"})
+
+	err := driver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.Error(err, "borked!")
+
+	info, err := s.js.StreamInfo("events")
+	s.NoError(err)
+	s.Equal(uint64(0), info.State.Msgs)
+}
+
+func (s *NATSDriverSuite) TestPublishesOnAggregateAndEventTypeSubject() {
+	sub, err := s.js.SubscribeSync("es.>")
+	s.NoError(err)
+
+	driver := es.NewNATSDriver(s.js, es.NewInMemoryDriver())
+	events := []*es.Event{
+		es.NewEvent("uuid-1", &SomethingHappened{Data: "1"}),
+		es.NewEvent("uuid-2", &SomethingElseHappened{Data: "2"}),
+	}
+	err = driver.Save(events)
+	s.NoError(err)
+
+	msg, err := sub.NextMsg(time.Second)
+	s.NoError(err)
+	s.Equal("es.SampleAggregate.SomethingHappened", msg.Subject)
+	s.Equal(events[0].ID, msg.Header.Get("Nats-Msg-Id"))
+
+	msg, err = sub.NextMsg(time.Second)
+	s.NoError(err)
+	s.Equal("es.AnotherSampleAggregate.SomethingElseHappened", msg.Subject)
+	s.Equal(events[1].ID, msg.Header.Get("Nats-Msg-Id"))
+}
+
+func (s *NATSDriverSuite) TestDeduplicatesPublicationsByEventID() {
+	for i := 0; i < 2; i++ {
+		driver := es.NewNATSDriver(s.js, es.NewInMemoryDriver())
+		err := driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{}, es.WithEventIDs(es.IDGeneratorFunc(func() string { return "event-id" })))})
+		s.NoError(err)
+	}
+
+	info, err := s.js.StreamInfo("events")
+	s.NoError(err)
+	s.Equal(uint64(1), info.State.Msgs)
+}
+
+func (s *NATSDriverSuite) TestSubscriberFeedsTypedHandlers() {
+	driver := es.NewNATSDriver(s.js, es.NewInMemoryDriver())
+	err := driver.Save([]*es.Event{
+		es.NewEvent("uuid-1", &SomethingHappened{Data: "1"}),
+		es.NewEvent("uuid-2", &SomethingElseHappened{Data: "2"}),
+		es.NewEvent("uuid-3", &SomethingHappened{Data: "3"}),
+	})
+	s.NoError(err)
+
+	received := make(chan *es.Event, 3)
+	subscriber := es.NewNATSSubscriber(s.js, "test-consumer")
+	subscriber.Handle(SomethingHappened{}, func(event *es.Event) error {
+		received <- event
+		return nil
+	})
+	sub, err := subscriber.Subscribe()
+	s.NoError(err)
+	defer func() {
+		s.NoError(sub.Unsubscribe())
+	}()
+
+	for _, data := range []string{"1", "3"} {
+		select {
+		case event := <-received:
+			s.Equal("SomethingHappened", event.Type)
+			s.Equal("uuid-"+data, event.AggregateID)
+			s.Equal(&SomethingHappened{Data: data}, event.Payload)
+		case <-time.After(time.Second):
+			s.Fail(fmt.Sprintf("Event %s was not handled", data))
+		}
+	}
+}
+
+func (s *NATSDriverSuite) TestSubscriberRegistersHandlersWhileSubscribed() {
+	driver := es.NewNATSDriver(s.js, es.NewInMemoryDriver())
+	received := make(chan *es.Event, 10)
+	subscriber := es.NewNATSSubscriber(s.js, "test-consumer")
+	subscriber.Handle(SomethingElseHappened{}, func(event *es.Event) error {
+		return nil
+	})
+	sub, err := subscriber.Subscribe()
+	s.NoError(err)
+	defer func() {
+		s.NoError(sub.Unsubscribe())
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			err := driver.Save([]*es.Event{es.NewEvent(fmt.Sprintf("uuid-%d", i), &SomethingElseHappened{Data: fmt.Sprint(i)})})
+			s.NoError(err)
+		}
+	}()
+	subscriber.Handle(SomethingHappened{}, func(event *es.Event) error {
+		received <- event
+		return nil
+	})
+	<-done
+
+	err = driver.Save([]*es.Event{es.NewEvent("uuid-10", &SomethingHappened{Data: "10"})})
+	s.NoError(err)
+	select {
+	case event := <-received:
+		s.Equal("uuid-10", event.AggregateID)
+	case <-time.After(time.Second):
+		s.Fail("Event was not handled")
+	}
+}
+
+func (s *NATSDriverSuite) TestSubscriberRedeliversWhenHandlerFails() {
+	driver := es.NewNATSDriver(s.js, es.NewInMemoryDriver())
+	err := driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{Data: "1"})})
+	s.NoError(err)
+
+	attempts := make(chan int, 2)
+	count := 0
+	subscriber := es.NewNATSSubscriber(s.js, "test-consumer")
+	subscriber.Handle(SomethingHappened{}, func(event *es.Event) error {
+		count++
+		attempts <- count
+		if count == 1 {
+			return fmt.Errorf("try again")
+		}
+		return nil
+	})
+	sub, err := subscriber.Subscribe()
+	s.NoError(err)
+	defer func() {
+		s.NoError(sub.Unsubscribe())
+	}()
+
+	for _, expected := range []int{1, 2} {
+		select {
+		case attempt := <-attempts:
+			s.Equal(expected, attempt)
+		case <-time.After(time.Second):
+			s.Fail(fmt.Sprintf("Attempt %d did not happen", expected))
+		}
+	}
+}
+
+func (s *NATSDriverSuite) TestEscapesSubjectTokens() {
+	s.Equal("es.Sample%2EAggregate.Something%2AHappened%3E", es.NATSSubject("Sample.Aggregate", "Something*Happened>"))
+	s.Equal("es.Sample%20Aggregate.100%25Happened", es.NATSSubject("Sample Aggregate", "100%Happened"))
+}
+
+func (s *NATSDriverSuite) TestSaveStopsWaitingForLostAcknowledgements() {
+	s.server.Shutdown()
+
+	driver := es.NewNATSDriver(s.js, es.NewInMemoryDriver(), es.WithNATSAckTimeout(100*time.Millisecond))
+	done := make(chan error)
+	go func() {
+		done <- driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{})})
+	}()
+
+	select {
+	case err := <-done:
+		s.NoError(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("Save did not time out")
+	}
+}
+
+func (s *NATSDriverSuite) TestSaveStopsWaitingWhenContextIsDone() {
+	s.server.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	driver := es.NewNATSDriver(s.js, es.NewInMemoryDriver(), es.WithNATSAckTimeout(time.Hour))
+	done := make(chan error)
+	go func() {
+		done <- driver.SaveContext(ctx, []*es.Event{es.NewEvent("uuid-1", &SomethingHappened{})})
+	}()
+
+	select {
+	case err := <-done:
+		s.NoError(err)
+	case <-time.After(5 * time.Second):
+		s.Fail("Save did not stop with the context")
+	}
+}
@@ -1,9 +1,10 @@
 package es
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/lib/pq"
@@ -13,6 +14,8 @@ import (
 const createTable = `
 	CREATE TABLE events (
 		ID               BIGSERIAL PRIMARY KEY,
+		EventID          VARCHAR(255) DEFAULT '' NOT NULL,
+		TenantID         VARCHAR(255) DEFAULT '' NOT NULL,
 		Type             VARCHAR(255) NOT NULL,
 		-- TODO: Author VARCHAR(255) NOT NULL,
 		Created          TIMESTAMPTZ DEFAULT now() NOT NULL,
@@ -21,13 +24,123 @@ const createTable = `
 		AggregateType    VARCHAR(255) NOT NULL,
 		Payload          JSON NOT NULL,
 
-		CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion)
-	)
+		CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion, TenantID)
+	);
+
+	CREATE INDEX EventsTenant ON events (TenantID, ID);
+`
+
+const addTenantColumn = `
+	ALTER TABLE events ADD COLUMN TenantID VARCHAR(255) DEFAULT '' NOT NULL;
+	ALTER TABLE events
+		DROP CONSTRAINT OptimisticLocking,
+		ADD CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion, TenantID);
+
+	CREATE INDEX EventsTenant ON events (TenantID, ID);
+`
+
+const addEventIDColumn = `
+	ALTER TABLE events ADD COLUMN EventID VARCHAR(255) DEFAULT '' NOT NULL;
 `
 
-// PostgresDriver implements a Postgres-backed event-store.
+const enableRowLevelSecurity = `
+	ALTER TABLE events ENABLE ROW LEVEL SECURITY;
+	ALTER TABLE events FORCE ROW LEVEL SECURITY;
+
+	CREATE POLICY TenantIsolation ON events
+		USING (TenantID = current_setting('es.tenant_id', true))
+		WITH CHECK (TenantID = current_setting('es.tenant_id', true));
+`
+
+const selectEvents = `
+	SELECT
+		ID,
+		EventID,
+		TenantID,
+		Type,
+		Created,
+		AggregateID,
+		AggregateVersion,
+		AggregateType,
+		Payload
+	FROM events
+`
+
+// uniqueViolation is the Postgres error code raised when a unique constraint
+// is violated
+const uniqueViolation = "23505"
+
+// PostgresOption configures a PostgresDriver
+type PostgresOption func(*PostgresDriver)
+
+// WithPostgresReplicas sends reads by type to the given replicas in turn. A
+// replica that hasn't replicated up to the requested position yet is
+// skipped, falling back to the primary.
+func WithPostgresReplicas(replicas ...*sql.DB) PostgresOption {
+	return func(d *PostgresDriver) {
+		d.replicas = replicas
+	}
+}
+
+// WithPostgresTenancy requires a tenant on every load, save and read
+func WithPostgresTenancy() PostgresOption {
+	return func(d *PostgresDriver) {
+		d.multiTenant = true
+	}
+}
+
+// WithPostgresRowLevelSecurity sets the context tenant as the `es.tenant_id`
+// setting of every transaction, for the policy created by
+// `EnableRowLevelSecurity` to enforce it
+func WithPostgresRowLevelSecurity() PostgresOption {
+	return func(d *PostgresDriver) {
+		d.rowLevelSecurity = true
+	}
+}
+
+// WithPostgresClock sets the clock stamping saved events. Without it, events
+// created at no time are stamped by the database.
+func WithPostgresClock(clock Clock) PostgresOption {
+	return func(d *PostgresDriver) {
+		d.clock = clock
+	}
+}
+
+// WithPostgresRegistry sets the registry decoding loaded events
+func WithPostgresRegistry(registry *Registry) PostgresOption {
+	return func(d *PostgresDriver) {
+		d.registry = registry
+	}
+}
+
+// NewPostgresDriver creates a PostgresDriver on the given primary database
+func NewPostgresDriver(db *sql.DB, options ...PostgresOption) *PostgresDriver {
+	d := &PostgresDriver{DB: db}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// PostgresDriver implements a Postgres-backed event-store. Saves and
+// aggregate loads always go to the primary `DB`. Versions are unique per
+// tenant and aggregate, and saved events keep their IDs, `ID` being their
+// position in the table. Tables created by earlier versions must be migrated
+// by `Migrate` first.
 type PostgresDriver struct {
-	DB *sql.DB
+	DB               *sql.DB
+	replicas         []*sql.DB
+	multiTenant      bool
+	rowLevelSecurity bool
+	clock            Clock
+	registry         *Registry
+	next             uint32
+}
+
+// queryer is implemented by both `*sql.DB` and `*sql.Tx`
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
 }
 
 // CreateTable creates the event-store table with the necessary columns and
@@ -42,84 +155,215 @@ func (d *PostgresDriver) CreateTable() error {
 	return nil
 }
 
+// Migrate creates the event-store table when missing, or adds the columns it
+// lacks when created by an earlier version
+func (d *PostgresDriver) Migrate() error {
+	var exists bool
+	err := d.DB.QueryRow(`SELECT to_regclass('events') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return d.CreateTable()
+	}
+
+	for _, migration := range []struct {
+		column string
+		add    func() error
+	}{
+		{column: "tenantid", add: d.AddTenantColumn},
+		{column: "eventid", add: d.AddEventIDColumn},
+	} {
+		var columns int
+		err = d.DB.QueryRow(`
+			SELECT COUNT(*)
+			FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'events' AND column_name = $1
+		`, migration.column).Scan(&columns)
+		if err != nil {
+			return err
+		}
+		if columns > 0 {
+			continue
+		}
+
+		err = migration.add()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddTenantColumn migrates an event-store table created before tenants were
+// supported, leaving existing events without a tenant and making versions
+// unique per tenant
+func (d *PostgresDriver) AddTenantColumn() error {
+	_, err := d.DB.Exec(addTenantColumn)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddEventIDColumn migrates an event-store table created before event IDs
+// were kept, existing events being loaded with their positions as IDs
+func (d *PostgresDriver) AddEventIDColumn() error {
+	_, err := d.DB.Exec(addEventIDColumn)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EnableRowLevelSecurity creates a policy restricting events to the tenant
+// set by `RowLevelSecurity` drivers, enforced even for the table owner. It
+// must be run by the table owner.
+func (d *PostgresDriver) EnableRowLevelSecurity() error {
+	_, err := d.DB.Exec(enableRowLevelSecurity)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Load loads all events for the given aggregateID ordered by version
 func (d *PostgresDriver) Load(aggregateID string) ([]*Event, error) {
-	rows, err := d.DB.Query(`
-		SELECT
-			ID,
-			Type,
-			Created,
-			AggregateID,
-			AggregateVersion,
-			AggregateType,
-			Payload
-		FROM events
-		WHERE AggregateID = $1
-		ORDER BY AggregateVersion
-	`, aggregateID)
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext loads all events for the given aggregateID ordered by version,
+// scoped to the context tenant
+func (d *PostgresDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
 	if err != nil {
 		return nil, err
 	}
-	defer ShouldClose(rows)
 
-	events, err := d.rowsToEvents(rows)
+	return d.queryEvents(ctx, d.DB, tenantID, selectEvents+`
+		WHERE AggregateID = $1 AND TenantID = $2
+		ORDER BY AggregateVersion
+	`, aggregateID, tenantID)
+}
+
+// LatestVersion returns the version of the latest event for the given
+// aggregateID, or zero when there are none, scoped to the context tenant
+func (d *PostgresDriver) LatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	err = d.scoped(ctx, d.DB, tenantID, func(q queryer) error {
+		return q.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(AggregateVersion), 0)
+			FROM events
+			WHERE AggregateID = $1 AND TenantID = $2
+		`, aggregateID, tenantID).Scan(&version)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// LoadAfter loads the events for the given aggregateID with a version greater
+// than the given one, ordered by version and scoped to the context tenant
+func (d *PostgresDriver) LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
 	if err != nil {
 		return nil, err
 	}
 
-	return events, nil
+	return d.queryEvents(ctx, d.DB, tenantID, selectEvents+`
+		WHERE AggregateID = $1 AND AggregateVersion > $2 AND TenantID = $3
+		ORDER BY AggregateVersion
+	`, aggregateID, version, tenantID)
 }
 
 // Save saves all given events in the underlying event-store table. It does so
 // in a transactional manner, meaning that if any of the events violates any
 // constraints, none of the events will be persisted.
 func (d *PostgresDriver) Save(events []*Event) error {
-	tx, err := d.DB.Begin() // TODO: double check the most appropriate isolation level for an append-only table (Read Committed?)
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext saves all given events like `Save`, stamping them with the
+// context tenant
+func (d *PostgresDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := stampTenant(ctx, events, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	clock := contextClock(ctx, d.clock)
+	tx, err := d.DB.BeginTx(ctx, nil) // TODO: double check the most appropriate isolation level for an append-only table (Read Committed?)
 	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.Prepare(`
+	stmt, err := tx.PrepareContext(ctx, `
 		INSERT INTO events (
+			EventID,
+			TenantID,
 			Type,
 			AggregateID,
 			AggregateVersion,
 			AggregateType,
-			Payload
-		) VALUES($1, $2, $3, $4, $5)
+			Payload,
+			Created
+		) VALUES($1, $2, $3, $4, $5, $6, $7, COALESCE($8::TIMESTAMPTZ, now()))
+		RETURNING ID
 	`)
 	if err != nil {
-		rErr := tx.Rollback()
-		if rErr != nil {
-			log.
-				Fatal().
-				Err(rErr).
-				Msg("Failed rolling back transaction")
-		}
+		rollback(tx)
 		return err
 	}
 	defer ShouldClose(stmt)
 
-	for _, event := range events {
-		payload, err := json.Marshal(event.Payload)
+	positions := make([]int64, len(events))
+	for i, event := range events {
+		payload, err := event.marshalPayload()
 		if err != nil {
+			rollback(tx)
 			return err
 		}
 
-		_, err = stmt.Exec(
+		// Without a clock or a creation time, the database tells the time
+		var created interface{}
+		if t := createdAt(event, clock, nil); !t.IsZero() {
+			created = t
+		}
+
+		if d.rowLevelSecurity {
+			err = setTenant(ctx, tx, event.TenantID)
+			if err != nil {
+				rollback(tx)
+				return err
+			}
+		}
+
+		err = stmt.QueryRowContext(
+			ctx,
+			event.ID,
+			event.TenantID,
 			event.Type,
 			event.AggregateID,
 			event.AggregateVersion,
 			event.AggregateType,
 			payload,
-		)
+			created,
+		).Scan(&positions[i])
 		if err != nil {
-			rErr := tx.Rollback()
-			if rErr != nil {
-				log.
-					Fatal().
-					Err(rErr).
-					Msg("Failed rolling back transaction")
+			rollback(tx)
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation && pqErr.Constraint == "optimisticlocking" {
+				return &conflictError{err: err}
 			}
 			return err
 		}
@@ -130,47 +374,177 @@ func (d *PostgresDriver) Save(events []*Event) error {
 		return err
 	}
 
+	for i, event := range events {
+		event.Position = positions[i]
+	}
 	return nil
 }
 
+// RemoveStream deletes all events for the given aggregateID, scoped to the
+// context tenant
+func (d *PostgresDriver) RemoveStream(ctx context.Context, aggregateID string) error {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if d.rowLevelSecurity {
+		err = setTenant(ctx, tx, tenantID)
+		if err != nil {
+			rollback(tx)
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM events
+		WHERE AggregateID = $1 AND TenantID = $2
+	`, aggregateID, tenantID)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // ReadEventsOfTypes .
 func (d *PostgresDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
-	rows, err := d.DB.Query(`
-   		SELECT
-			ID,
-			Type,
-			Created,
-			AggregateID,
-			AggregateVersion,
-			AggregateType,
-			Payload
-		FROM events
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext reads events of the given types after the given
+// position, scoped to the context tenant
+func (d *PostgresDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+	types = contextRegistry(ctx, d.registry).readTypes(types)
+
+	return d.queryEvents(ctx, d.reader(ctx, tenantID, position), tenantID, selectEvents+`
 		WHERE ID > $1 AND
-		Type = ANY($3) -- TODO: Replace with IN
+		Type = ANY($3) AND -- TODO: Replace with IN
+		TenantID = $4
 		ORDER BY ID
 		LIMIT $2
-	`, position, count, pq.Array(types))
+	`, position, count, pq.Array(types), tenantID)
+}
+
+// reader returns the next replica that caught up with the given position,
+// or the primary if none did
+func (d *PostgresDriver) reader(ctx context.Context, tenantID string, position int64) *sql.DB {
+	if len(d.replicas) == 0 {
+		return d.DB
+	}
+
+	start := atomic.AddUint32(&d.next, 1)
+	for i := range d.replicas {
+		replica := d.replicas[(start+uint32(i))%uint32(len(d.replicas))]
+
+		var replicated int64
+		err := d.scoped(ctx, replica, tenantID, func(q queryer) error {
+			return q.QueryRowContext(ctx, `SELECT COALESCE(MAX(ID), 0) FROM events`).Scan(&replicated)
+		})
+		if err != nil {
+			log.
+				Warn().
+				Err(err).
+				Msg("Failed checking replica position")
+
+			continue
+		}
+		if replicated >= position {
+			return replica
+		}
+	}
 
+	return d.DB
+}
+
+// queryEvents runs the given query on db, scoped to the given tenant
+func (d *PostgresDriver) queryEvents(ctx context.Context, db *sql.DB, tenantID string, query string, args ...interface{}) ([]*Event, error) {
+	var events []*Event
+	err := d.scoped(ctx, db, tenantID, func(q queryer) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer ShouldClose(rows)
+
+		events, err = rowsToEvents(rows, contextRegistry(ctx, d.registry))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer ShouldClose(rows)
 
-	events, err := d.rowsToEvents(rows)
+	return events, nil
+}
+
+// scoped calls fn with db, or with a read-only transaction setting the given
+// tenant when row level security is enabled
+func (d *PostgresDriver) scoped(ctx context.Context, db *sql.DB, tenantID string, fn func(q queryer) error) error {
+	if !d.rowLevelSecurity {
+		return fn(db)
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	err = setTenant(ctx, tx, tenantID)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		rollback(tx)
+		return err
 	}
 
-	return events, err
+	return tx.Commit()
+}
+
+// setTenant sets the tenant enforced by row level security until the end of
+// the transaction
+func setTenant(ctx context.Context, tx *sql.Tx, tenantID string) error {
+	_, err := tx.ExecContext(ctx, `SELECT set_config('es.tenant_id', $1, true)`, tenantID)
+	return err
 }
 
-func (d *PostgresDriver) rowsToEvents(rows *sql.Rows) ([]*Event, error) {
+// rollback rolls back the given transaction, unless already rolled back by
+// a cancelled context. Warns otherwise, as the connection is likely broken
+// and the transaction aborted anyway.
+func rollback(tx *sql.Tx) {
+	err := tx.Rollback()
+	if err != nil && err != sql.ErrTxDone {
+		log.
+			Warn().
+			Err(err).
+			Msg("Failed rolling back transaction")
+	}
+}
+
+// rowsToEvents decodes the rows selected by `selectEvents` with the given
+// registry, leaving out those of unknown types skipped by it
+func rowsToEvents(rows *sql.Rows, registry *Registry) ([]*Event, error) {
 	var events []*Event
 	for rows.Next() {
 		var event Event
 		var rawPayload []byte
 		err := rows.Scan(
+			&event.Position,
 			&event.ID,
+			&event.TenantID,
 			&event.Type,
 			&event.Created,
 			&event.AggregateID,
@@ -181,16 +555,14 @@ func (d *PostgresDriver) rowsToEvents(rows *sql.Rows) ([]*Event, error) {
 		if err != nil {
 			return nil, err
 		}
-		typedPayload, err := resolveType(event.Type)
+		event.ID = storedID(event.ID, event.Position)
+		keep, err := registry.decodeEvent(&event, rawPayload)
 		if err != nil {
 			return nil, err
 		}
-		err = json.Unmarshal(rawPayload, typedPayload)
-		if err != nil {
-			return nil, err
+		if keep {
+			events = append(events, &event)
 		}
-		event.Payload = typedPayload
-		events = append(events, &event)
 	}
 	err := rows.Err()
 	if err != nil {
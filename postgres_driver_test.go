@@ -1,13 +1,18 @@
 package es_test
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -34,16 +39,8 @@ func TestPostgresDriverSuite(t *testing.T) {
 func (s *PostgresDriverSuite) SetupTest() {
 	s.db = es.MustConnect(os.Getenv("POSTGRES_URL"))
 
-	_, err := s.db.Exec(`
-		CREATE SCHEMA stub; CREATE FUNCTION stub.now() RETURNS TIMESTAMPTZ LANGUAGE SQL AS $$ SELECT '1985-10-26 01:22+00'::timestamptz; $$;
-		SET search_path = stub,"$user",public,pg_catalog;
-	`)
-	s.NoError(err)
-
-	postgresDriver := &es.PostgresDriver{
-		DB: s.db,
-	}
-	err = postgresDriver.CreateTable()
+	postgresDriver := es.NewPostgresDriver(s.db, es.WithPostgresClock(es.FixedClock(time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC))))
+	err := postgresDriver.CreateTable()
 	s.NoError(err)
 
 	s.driver = postgresDriver
@@ -52,8 +49,6 @@ func (s *PostgresDriverSuite) SetupTest() {
 func (s *PostgresDriverSuite) TearDownTest() {
 	_, err := s.db.Exec(`DROP TABLE IF EXISTS events`)
 	s.NoError(err)
-	_, err = s.db.Exec(`DROP SCHEMA IF EXISTS stub CASCADE`)
-	s.NoError(err)
 	err = s.db.Close()
 	s.NoError(err)
 }
@@ -144,6 +139,222 @@ func (s *PostgresDriverSuite) TestLoad() {
 	}, events)
 }
 
+func (s *PostgresDriverSuite) TestLatestVersionAndLoadAfter() {
+	err := s.driver.Save([]*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V1"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 2,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V2"},
+		},
+	})
+	s.NoError(err)
+
+	postgresDriver := s.driver.(*es.PostgresDriver)
+	version, err := postgresDriver.LatestVersion(context.Background(), phonyUUID(1))
+	s.NoError(err)
+	s.Equal(int64(2), version)
+
+	version, err = postgresDriver.LatestVersion(context.Background(), phonyUUID(2))
+	s.NoError(err)
+	s.Equal(int64(0), version)
+
+	events, err := postgresDriver.LoadAfter(context.Background(), phonyUUID(1), 1)
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "AggregateID#1 - V2"}, events[0].Payload)
+
+	events, err = postgresDriver.LoadAfter(context.Background(), phonyUUID(1), 2)
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *PostgresDriverSuite) TestTenantIsolation() {
+	postgresDriver := es.NewPostgresDriver(s.db, es.WithPostgresTenancy())
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+
+	err := postgresDriver.SaveContext(acme, []*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "acme"},
+		},
+	})
+	s.NoError(err)
+	err = postgresDriver.Save([]*es.Event{
+		{
+			TenantID:         "globex",
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(2),
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "globex"},
+		},
+	})
+	s.NoError(err, "Tenant set explicitly")
+
+	events, err := postgresDriver.LoadContext(acme, phonyUUID(1))
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("acme", events[0].TenantID)
+	events, err = postgresDriver.LoadContext(globex, phonyUUID(1))
+	s.NoError(err)
+	s.Empty(events)
+
+	events, err = postgresDriver.ReadEventsOfTypesContext(globex, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "globex"}, events[0].Payload)
+
+	version, err := postgresDriver.LatestVersion(globex, phonyUUID(1))
+	s.NoError(err)
+	s.Equal(int64(0), version)
+
+	_, err = postgresDriver.Load(phonyUUID(1))
+	s.Equal(es.ErrTenantRequired, err)
+	_, err = postgresDriver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.Equal(es.ErrTenantRequired, err)
+	err = postgresDriver.Save([]*es.Event{es.NewEvent(phonyUUID(3), &SomethingHappened{})})
+	s.Equal(es.ErrTenantRequired, err)
+	err = postgresDriver.SaveContext(acme, []*es.Event{{TenantID: "globex", AggregateID: phonyUUID(3)}})
+	s.Equal(es.ErrTenantMismatch, err)
+}
+
+func (s *PostgresDriverSuite) TestMigrateCreatesMissingTable() {
+	_, err := s.db.Exec(`DROP TABLE events`)
+	s.Require().NoError(err)
+
+	postgresDriver := &es.PostgresDriver{DB: s.db}
+	err = postgresDriver.Migrate()
+	s.Require().NoError(err)
+	err = postgresDriver.Migrate()
+	s.Require().NoError(err, "Migrating is idempotent")
+
+	event := es.NewEvent(phonyUUID(1), &SomethingHappened{})
+	event.AggregateVersion = 1
+	err = postgresDriver.Save([]*es.Event{event})
+	s.NoError(err)
+}
+
+func (s *PostgresDriverSuite) TestMigrate() {
+	_, err := s.db.Exec(`DROP TABLE events`)
+	s.Require().NoError(err)
+	_, err = s.db.Exec(`
+		CREATE TABLE events (
+			ID               BIGSERIAL PRIMARY KEY,
+			Type             VARCHAR(255) NOT NULL,
+			Created          TIMESTAMPTZ DEFAULT now() NOT NULL,
+			AggregateID      UUID NOT NULL,
+			AggregateVersion INT NOT NULL,
+			AggregateType    VARCHAR(255) NOT NULL,
+			Payload          JSON NOT NULL,
+
+			CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion)
+		)
+	`)
+	s.Require().NoError(err)
+	_, err = s.db.Exec(`
+		INSERT INTO events (Type, AggregateID, AggregateVersion, AggregateType, Payload)
+		VALUES ('SomethingHappened', $1, 1, 'SampleAggregate', '{"Data":"legacy"}')
+	`, phonyUUID(1))
+	s.Require().NoError(err)
+
+	postgresDriver := &es.PostgresDriver{DB: s.db}
+	err = postgresDriver.Migrate()
+	s.Require().NoError(err)
+	err = postgresDriver.Migrate()
+	s.Require().NoError(err, "Migrating is idempotent")
+
+	events, err := postgresDriver.Load(phonyUUID(1))
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("", events[0].TenantID, "Existing events are left without a tenant")
+	s.Equal("1", events[0].ID, "Existing events are loaded with their positions as IDs")
+	s.Equal(&SomethingHappened{Data: "legacy"}, events[0].Payload)
+
+	event := es.NewEvent(phonyUUID(1), &SomethingHappened{Data: "acme"})
+	event.AggregateVersion = 1
+	err = postgresDriver.SaveContext(es.WithTenant(context.Background(), "acme"), []*es.Event{event})
+	s.NoError(err, "Versions are unique per tenant")
+	event = es.NewEvent(phonyUUID(1), &SomethingHappened{})
+	event.AggregateVersion = 1
+	err = postgresDriver.Save([]*es.Event{event})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+}
+
+func (s *PostgresDriverSuite) TestRowLevelSecurity() {
+	err := (&es.PostgresDriver{DB: s.db}).EnableRowLevelSecurity()
+	s.Require().NoError(err)
+
+	// Superusers bypass row level security, so the driver runs as a plain role
+	_, err = s.db.Exec(`
+		CREATE ROLE es_tenant NOLOGIN;
+		GRANT SELECT, INSERT, DELETE ON events TO es_tenant;
+		GRANT USAGE ON SEQUENCE events_id_seq TO es_tenant;
+	`)
+	s.Require().NoError(err)
+	defer func() {
+		_, err := s.db.Exec(`DROP OWNED BY es_tenant; DROP ROLE es_tenant`)
+		s.NoError(err)
+	}()
+	db := es.MustConnect(os.Getenv("POSTGRES_URL"))
+	defer es.ShouldClose(db)
+	_, err = db.Exec(`SET ROLE es_tenant`)
+	s.Require().NoError(err)
+
+	postgresDriver := es.NewPostgresDriver(db, es.WithPostgresRowLevelSecurity())
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+	err = postgresDriver.SaveContext(acme, []*es.Event{es.NewEvent(phonyUUID(1), &SomethingHappened{Data: "acme"})})
+	s.Require().NoError(err)
+	err = postgresDriver.SaveContext(globex, []*es.Event{es.NewEvent(phonyUUID(2), &SomethingHappened{Data: "globex"})})
+	s.Require().NoError(err)
+
+	events, err := postgresDriver.ReadEventsOfTypesContext(acme, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "acme"}, events[0].Payload)
+	events, err = postgresDriver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events, "Tenant events are hidden without a tenant")
+
+	tx, err := db.Begin()
+	s.Require().NoError(err)
+	defer func() {
+		s.NoError(tx.Rollback())
+	}()
+	_, err = tx.Exec(`SELECT set_config('es.tenant_id', 'acme', true)`)
+	s.Require().NoError(err)
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count)
+	s.NoError(err)
+	s.Equal(1, count, "Events of other tenants are not read")
+
+	result, err := tx.Exec(`DELETE FROM events WHERE TenantID = 'globex'`)
+	s.NoError(err)
+	deleted, err := result.RowsAffected()
+	s.NoError(err)
+	s.Equal(int64(0), deleted, "Events of other tenants are not deleted")
+
+	_, err = tx.Exec(`
+		INSERT INTO events (TenantID, Type, AggregateID, AggregateVersion, AggregateType, Payload)
+		VALUES ('globex', 'SomethingHappened', $1, 2, 'SampleAggregate', '{}')
+	`, phonyUUID(2))
+	s.Error(err, "Events of other tenants are not written")
+}
+
 func (s *PostgresDriverSuite) TestSave() {
 	events := []*es.Event{
 		{
@@ -247,6 +458,7 @@ func (s *PostgresDriverSuite) TestSaveOptimisticLocking() {
 	err = s.driver.Save(events)
 	s.Error(err)
 	s.Regexp(".*violates unique constraint.*", err.Error())
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
 }
 
 func (s *PostgresDriverSuite) TestSaveInTransaction() {
@@ -470,6 +682,94 @@ func (s *PostgresDriverSuite) TestReadEventsForward() {
 	s.Empty(events, "Returns no events when there are no events for that type")
 }
 
+func (s *PostgresDriverSuite) TestReadEventsLazily() {
+	err := s.driver.Save([]*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "SampleAggregate",
+			Payload:          &SomethingHappened{Data: "lazy"},
+		},
+	})
+	s.NoError(err)
+
+	registry := es.NewRegistry()
+	s.NoError(registry.Register(SomethingHappened{}))
+	registry.SetLazyDecoding(true)
+	driver := es.NewPostgresDriver(s.db, es.WithPostgresRegistry(registry))
+
+	events, err := driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Nil(events[0].Payload)
+
+	payload, err := events[0].DecodePayload()
+	s.NoError(err)
+	s.Equal(&SomethingHappened{Data: "lazy"}, payload)
+}
+
+func (s *PostgresDriverSuite) TestReadEventsFromCaughtUpReplicas() {
+	replicaDB := es.MustConnect(os.Getenv("POSTGRES_URL"))
+	defer es.ShouldClose(replicaDB)
+	_, err := replicaDB.Exec(`
+		CREATE SCHEMA replica;
+		SET search_path = replica,"$user",public,pg_catalog;
+	`)
+	s.NoError(err)
+	defer func() {
+		_, err := replicaDB.Exec(`DROP SCHEMA IF EXISTS replica CASCADE`)
+		s.NoError(err)
+	}()
+
+	replicaDriver := &es.PostgresDriver{DB: replicaDB}
+	err = replicaDriver.CreateTable()
+	s.NoError(err)
+
+	primaryEvents := []*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 1,
+			AggregateType:    "SampleAggregate",
+			Payload:          &SomethingHappened{Data: "primary 1"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 2,
+			AggregateType:    "SampleAggregate",
+			Payload:          &SomethingHappened{Data: "primary 2"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      phonyUUID(1),
+			AggregateVersion: 3,
+			AggregateType:    "SampleAggregate",
+			Payload:          &SomethingHappened{Data: "primary 3"},
+		},
+	}
+	err = s.driver.Save(primaryEvents)
+	s.NoError(err)
+	err = replicaDriver.Save(primaryEvents[:1])
+	s.NoError(err)
+
+	driver := es.NewPostgresDriver(s.db, es.WithPostgresReplicas(replicaDB))
+
+	events, err := driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events), "Reads from the replica")
+
+	events, err = driver.ReadEventsOfTypes(2, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events), "Reads from the primary, the replica being behind position 2")
+	s.Equal(&SomethingHappened{Data: "primary 3"}, events[0].Payload)
+
+	events, err = driver.Load(phonyUUID(1))
+	s.NoError(err)
+	s.Equal(3, len(events), "Loads from the primary")
+}
+
 func readResult(rows *sql.Rows) ([]*Row, error) {
 	defer es.ShouldClose(rows)
 	var result []*Row
@@ -495,3 +795,16 @@ func readResult(rows *sql.Rows) ([]*Row, error) {
 func phonyUUID(n int) string {
 	return fmt.Sprintf("00000000-0000-0000-0000-%012d", n)
 }
+
+func TestPostgresDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		db := es.MustConnect(os.Getenv("POSTGRES_URL"))
+		driver := &es.PostgresDriver{DB: db}
+		require.NoError(t, driver.CreateTable())
+		return driver, func() {
+			_, err := db.Exec(`DROP TABLE IF EXISTS events`)
+			assert.NoError(t, err)
+			es.ShouldClose(db)
+		}
+	})
+}
@@ -1,25 +1,81 @@
 package es
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 )
 
-var registry = NewRegistry()
+// DefaultRegistry is the registry of `Register`, decoding events for stores
+// and drivers given no registry of their own
+var DefaultRegistry = NewRegistry()
 
 type typeBuilder func() interface{}
 
-// Registry is a type registry meant to be used as a way to get interfaces from type names
+// UnknownTypePolicy tells how drivers decode loaded events whose type isn't
+// registered
+type UnknownTypePolicy int
+
+const (
+	// FailUnknownTypes fails the whole load or read
+	FailUnknownTypes UnknownTypePolicy = iota
+	// SkipUnknownTypes leaves the events out. Reads by type leave them out
+	// before limiting, so pages never come back short for them.
+	SkipUnknownTypes
+	// KeepUnknownTypes decodes the events with a `*RawPayload`
+	KeepUnknownTypes
+)
+
+// UnknownTypeHook is called with every loaded event whose type isn't
+// registered, its payload left as a `*RawPayload`, whatever the policy.
+// Reads by type skipping unknown types never load them.
+type UnknownTypeHook func(event *Event)
+
+// RawPayload holds the JSON payload of an event whose type isn't registered.
+// It's encoded back as it was loaded, so it can be saved elsewhere as is.
+type RawPayload struct {
+	TypeName          string
+	AggregateTypeName string
+	JSON              json.RawMessage
+}
+
+// PayloadType implements `EventPayload`
+func (p *RawPayload) PayloadType() string {
+	return p.TypeName
+}
+
+// AggregateType implements `EventPayload`
+func (p *RawPayload) AggregateType() string {
+	return p.AggregateTypeName
+}
+
+// MarshalJSON implements `json.Marshaler`
+func (p RawPayload) MarshalJSON() ([]byte, error) {
+	return p.JSON, nil
+}
+
+// Registry is a type registry meant to be used as a way to get interfaces from type names.
+// It's safe for concurrent use.
 type Registry struct {
-	entries map[string]typeBuilder
+	mutex      sync.RWMutex
+	entries    map[string]typeBuilder
+	schemas    map[string]*Schema
+	policy     UnknownTypePolicy
+	hooks      []UnknownTypeHook
+	lazy       bool
+	strict     bool
+	driftHooks []SchemaDriftHook
 }
 
 // NewRegistry creates an empty type registry
-func NewRegistry() Registry {
-	return Registry{
+func NewRegistry() *Registry {
+	return &Registry{
 		entries: map[string]typeBuilder{},
+		schemas: map[string]*Schema{},
 	}
 }
 
@@ -30,6 +86,9 @@ func (r *Registry) Register(i EventPayload) error {
 		return fmt.Errorf("Pointers not allowed")
 	}
 
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	name := i.PayloadType()
 	if _, ok := r.entries[name]; ok {
 		return fmt.Errorf("Event payload already registered with name '%s'", name)
@@ -38,13 +97,16 @@ func (r *Registry) Register(i EventPayload) error {
 	r.entries[name] = func() interface{} {
 		return reflect.New(t).Interface()
 	}
+	r.schemas[name] = generateSchema(i)
 
 	return nil
 }
 
 // ResolveType looks for a registered type and returns a new pointer to it
 func (r *Registry) ResolveType(name string) (interface{}, error) {
+	r.mutex.RLock()
 	resolve, ok := r.entries[name]
+	r.mutex.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("No type registered for '%s'", name)
 	}
@@ -52,9 +114,116 @@ func (r *Registry) ResolveType(name string) (interface{}, error) {
 	return resolve(), nil
 }
 
+// Decode unmarshals the given JSON into a new pointer to the type registered
+// with the given name
+func (r *Registry) Decode(name string, data []byte) (interface{}, error) {
+	payload, err := r.ResolveType(name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// SetUnknownTypePolicy sets how loaded events whose type isn't registered
+// are decoded. Defaults to `FailUnknownTypes`.
+func (r *Registry) SetUnknownTypePolicy(policy UnknownTypePolicy) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.policy = policy
+}
+
+// SetLazyDecoding sets whether loaded events of registered types keep their
+// raw payload until `Event.DecodePayload` is called, making scans only
+// looking at types, aggregates or positions cheaper. Defaults to false.
+func (r *Registry) SetLazyDecoding(lazy bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lazy = lazy
+}
+
+// OnUnknownType adds a hook reporting loaded events whose type isn't
+// registered
+func (r *Registry) OnUnknownType(hook UnknownTypeHook) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.hooks = append(r.hooks, hook)
+}
+
+// decodeEvent sets the payload of the given event from the given JSON,
+// returning whether to keep the event according to the unknown type policy
+func (r *Registry) decodeEvent(event *Event, data []byte) (bool, error) {
+	r.mutex.RLock()
+	resolve, ok := r.entries[event.Type]
+	policy, hooks, lazy := r.policy, r.hooks, r.lazy
+	schema, strict, driftHooks := r.schemas[event.Type], r.strict, r.driftHooks
+	r.mutex.RUnlock()
+
+	if ok && strict {
+		reportDrift(event, schema.Validate(data), driftHooks)
+	}
+	if ok && lazy {
+		event.raw, event.registry = data, r
+		return true, nil
+	}
+	if ok {
+		payload := resolve()
+		err := json.Unmarshal(data, payload)
+		if err != nil {
+			return false, err
+		}
+		event.Payload = payload
+		return true, nil
+	}
+
+	event.Payload = &RawPayload{
+		TypeName:          event.Type,
+		AggregateTypeName: event.AggregateType,
+		JSON:              append(json.RawMessage{}, data...),
+	}
+	for _, hook := range hooks {
+		hook(event)
+	}
+
+	switch policy {
+	case SkipUnknownTypes:
+		return false, nil
+	case KeepUnknownTypes:
+		return true, nil
+	default:
+		return false, fmt.Errorf("No type registered for '%s'", event.Type)
+	}
+}
+
+// readTypes returns the given types, leaving out those skipped as unknown for
+// drivers to limit reads to the events kept
+func (r *Registry) readTypes(types []string) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if r.policy != SkipUnknownTypes {
+		return types
+	}
+	known := []string{}
+	for _, t := range types {
+		if _, ok := r.entries[t]; ok {
+			known = append(known, t)
+		}
+	}
+	return known
+}
+
 // Register event type with payload value
 func Register(i EventPayload) {
-	err := registry.Register(i)
+	err := DefaultRegistry.Register(i)
 	if err != nil {
 		log.
 			Fatal().
@@ -63,6 +232,22 @@ func Register(i EventPayload) {
 	}
 }
 
-func resolveType(name string) (interface{}, error) {
-	return registry.ResolveType(name)
+type registryKey struct{}
+
+// WithRegistry returns a copy of the context carrying the given registry.
+// Drivers decode loaded events with it rather than with their own.
+func WithRegistry(ctx context.Context, registry *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, registry)
+}
+
+// contextRegistry returns the registry carried by the context, else the
+// given one, else the default one
+func contextRegistry(ctx context.Context, fallback *Registry) *Registry {
+	if registry, ok := ctx.Value(registryKey{}).(*Registry); ok {
+		return registry
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return DefaultRegistry
 }
@@ -1,6 +1,9 @@
 package es_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/indebted-modules/es"
@@ -52,3 +55,154 @@ func (s *RegistrySuite) TestRegisterFailsIfTypeIsPointer() {
 	err := r.Register(&SomethingHappened{})
 	s.Equal("Pointers not allowed", err.Error())
 }
+
+func (s *RegistrySuite) TestDecodeUnmarshalsIntoRegisteredType() {
+	r := es.NewRegistry()
+	err := r.Register(SomethingHappened{})
+	s.Nil(err)
+
+	payload, err := r.Decode("SomethingHappened", []byte(`{"Data":"data"}`))
+	s.Nil(err)
+	s.Equal(&SomethingHappened{Data: "data"}, payload)
+
+	_, err = r.Decode("SomethingHappened", []byte(`{`))
+	s.Error(err)
+	_, err = r.Decode("UnregisteredType", []byte(`{}`))
+	s.Equal("No type registered for 'UnregisteredType'", err.Error())
+}
+
+func (s *RegistrySuite) TestRegistriesAreIsolated() {
+	_, err := privateRegistry().ResolveType("SomethingPrivateHappened")
+	s.Nil(err)
+	_, err = es.DefaultRegistry.ResolveType("SomethingPrivateHappened")
+	s.Error(err)
+}
+
+func (s *RegistrySuite) TestConcurrentRegisterAndResolve() {
+	r := es.NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			s.Nil(r.Register(numbered(i)))
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = r.ResolveType(numbered(i).PayloadType())
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 50; i++ {
+		_, err := r.ResolveType(numbered(i).PayloadType())
+		s.Nil(err)
+	}
+}
+
+func (s *RegistrySuite) TestFailsOnUnknownTypesByDefault() {
+	r := es.NewRegistry()
+	s.Nil(r.Register(SomethingHappened{}))
+	driver := s.driverWithUnknownType(r)
+
+	_, err := driver.Load("AggregateID#1")
+	s.EqualError(err, "No type registered for 'SomethingPrivateHappened'")
+}
+
+func (s *RegistrySuite) TestSkipsUnknownTypes() {
+	r := es.NewRegistry()
+	s.Nil(r.Register(SomethingHappened{}))
+	r.SetUnknownTypePolicy(es.SkipUnknownTypes)
+	var reported []int64
+	r.OnUnknownType(func(event *es.Event) {
+		reported = append(reported, event.Position)
+	})
+	driver := s.driverWithUnknownType(r)
+
+	events, err := driver.Load("AggregateID#1")
+	s.Nil(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "known"}, events[0].Payload)
+	s.Equal([]int64{2}, reported)
+}
+
+func (s *RegistrySuite) TestKeepsUnknownTypesRaw() {
+	r := es.NewRegistry()
+	s.Nil(r.Register(SomethingHappened{}))
+	r.SetUnknownTypePolicy(es.KeepUnknownTypes)
+	driver := s.driverWithUnknownType(r)
+
+	events, err := driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened", "SomethingPrivateHappened"})
+	s.Nil(err)
+	s.Equal(2, len(events))
+	raw, ok := events[1].Payload.(*es.RawPayload)
+	s.True(ok)
+	s.Equal("SomethingPrivateHappened", raw.PayloadType())
+	s.Equal("SampleAggregate", raw.AggregateType())
+	s.JSONEq(`{"Data":"unknown"}`, string(raw.JSON))
+
+	data, err := json.Marshal(raw)
+	s.Nil(err)
+	s.JSONEq(`{"Data":"unknown"}`, string(data), "Encoded back as loaded")
+}
+
+func (s *RegistrySuite) TestDecodesLazily() {
+	r := es.NewRegistry()
+	s.Nil(r.Register(SomethingHappened{}))
+	s.Nil(r.Register(SomethingPrivateHappened{}))
+	r.SetLazyDecoding(true)
+	driver := s.driverWithUnknownType(r)
+
+	events, err := driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened", "SomethingPrivateHappened"})
+	s.Nil(err)
+	s.Equal(2, len(events))
+	s.Nil(events[1].Payload)
+	s.Equal("SomethingPrivateHappened", events[1].Type)
+
+	payload, err := events[1].DecodePayload()
+	s.Nil(err)
+	s.Equal(&SomethingPrivateHappened{Data: "unknown"}, payload)
+	s.Equal(payload, events[1].Payload)
+
+	copied := es.NewInMemoryDriver()
+	s.Nil(copied.Save(events[:1]))
+	loaded, err := copied.Load("AggregateID#1")
+	s.Nil(err)
+	s.Equal(&SomethingHappened{Data: "known"}, loaded[0].Payload, "Saves the payload of events not decoded yet")
+}
+
+func (s *RegistrySuite) TestDecodesLazilyOnlyKnownTypes() {
+	r := es.NewRegistry()
+	s.Nil(r.Register(SomethingHappened{}))
+	r.SetLazyDecoding(true)
+	r.SetUnknownTypePolicy(es.SkipUnknownTypes)
+	driver := s.driverWithUnknownType(r)
+
+	events, err := driver.Load("AggregateID#1")
+	s.Nil(err)
+	s.Equal(1, len(events))
+	s.Equal("SomethingHappened", events[0].Type)
+}
+
+// driverWithUnknownType saves a known then an unknown event to a driver
+// decoding with the given registry
+func (s *RegistrySuite) driverWithUnknownType(r *es.Registry) *es.InMemoryDriver {
+	driver := es.NewInMemoryDriver(es.WithInMemoryRegistry(r))
+	known := es.NewEvent("AggregateID#1", &SomethingHappened{Data: "known"})
+	known.AggregateVersion = 1
+	unknown := es.NewEvent("AggregateID#1", &SomethingPrivateHappened{Data: "unknown"})
+	unknown.AggregateVersion = 2
+	s.Require().Nil(driver.Save([]*es.Event{known, unknown}))
+	return driver
+}
+
+// numbered is a payload type registered under as many names as numbers
+type numbered int
+
+func (n numbered) PayloadType() string {
+	return fmt.Sprintf("Numbered#%d", n)
+}
+
+func (numbered) AggregateType() string {
+	return "Numbers"
+}
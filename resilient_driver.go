@@ -0,0 +1,250 @@
+package es
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrCircuitOpen is returned by the ResilientDriver while its circuit breaker
+// is open, without calling the internal driver
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ResilientOption configures a ResilientDriver
+type ResilientOption func(*ResilientDriver)
+
+// WithResilientRetries sets how many attempts are made per call and the
+// exponential backoff between them. Defaults to 3 attempts, waiting from
+// 50ms up to 1s.
+func WithResilientRetries(attempts int, backoff time.Duration, maxBackoff time.Duration) ResilientOption {
+	return func(d *ResilientDriver) {
+		d.attempts = attempts
+		d.backoff = backoff
+		d.maxBackoff = maxBackoff
+	}
+}
+
+// WithResilientBreaker sets how many consecutive transient failures open the
+// circuit breaker and how long it stays open before letting a trial call
+// through. Defaults to 5 failures and 10s.
+func WithResilientBreaker(failures int, cooldown time.Duration) ResilientOption {
+	return func(d *ResilientDriver) {
+		d.threshold = failures
+		d.cooldown = cooldown
+	}
+}
+
+// NewResilientDriver creates a new ResilientDriver
+func NewResilientDriver(driver Driver, options ...ResilientOption) *ResilientDriver {
+	d := &ResilientDriver{
+		Driver:     driver,
+		attempts:   3,
+		backoff:    50 * time.Millisecond,
+		maxBackoff: time.Second,
+		threshold:  5,
+		cooldown:   10 * time.Second,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// ResilientDriver implementation retrying transient database failures and
+// failing fast once they are sustained. Reads are retried on any transient
+// failure, while saves are only retried when the failure guarantees nothing
+// was committed. Optimistic locking violations are never retried.
+type ResilientDriver struct {
+	Driver     Driver
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	threshold  int
+	cooldown   time.Duration
+
+	mutex    sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+type failureKind int
+
+const (
+	// permanentFailure won't go away by retrying
+	permanentFailure failureKind = iota
+	// transientFailure may go away by retrying, but the outcome of a write is
+	// unknown
+	transientFailure
+	// abortedFailure may go away by retrying and guarantees nothing was
+	// written
+	abortedFailure
+)
+
+// Load delegates to internal driver
+func (d *ResilientDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (d *ResilientDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	var events []*Event
+	err := d.do(ctx, transientFailure, func() error {
+		var err error
+		events, err = loadContext(ctx, d.Driver, aggregateID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Save delegates to internal driver
+func (d *ResilientDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (d *ResilientDriver) SaveContext(ctx context.Context, events []*Event) error {
+	return d.do(ctx, abortedFailure, func() error {
+		return saveContext(ctx, d.Driver, events)
+	})
+}
+
+// ReadEventsOfTypes delegates to internal driver
+func (d *ResilientDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *ResilientDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	var events []*Event
+	err := d.do(ctx, transientFailure, func() error {
+		var err error
+		events, err = readEventsOfTypesContext(ctx, d.Driver, position, count, types)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// do calls fn until it succeeds, fails with an error not worth retrying, or
+// runs out of attempts or of circuit. Errors are retried when at least as
+// safe to retry as the given kind.
+func (d *ResilientDriver) do(ctx context.Context, retryable failureKind, fn func() error) error {
+	var err error
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		if !d.allow() {
+			if err != nil {
+				return err
+			}
+			return ErrCircuitOpen
+		}
+
+		err = fn()
+		kind := classifyFailure(err)
+		d.record(err, kind)
+		if err == nil || kind < retryable || attempt >= d.attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// allow tells whether the circuit breaker lets a call through, letting a
+// single trial call through once the cooldown has elapsed
+func (d *ResilientDriver) allow() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.failures < d.threshold {
+		return true
+	}
+	if d.trial || time.Since(d.openedAt) < d.cooldown {
+		return false
+	}
+	d.trial = true
+	return true
+}
+
+func (d *ResilientDriver) record(err error, kind failureKind) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.trial = false
+	if err == nil || kind == permanentFailure {
+		d.failures = 0
+		return
+	}
+
+	d.failures++
+	if d.failures >= d.threshold {
+		d.openedAt = time.Now()
+	}
+}
+
+// classifyFailure tells whether the given error is worth retrying and, if
+// so, whether a write attempt may have been committed
+func classifyFailure(err error) failureKind {
+	if err == nil || errors.Is(err, ErrOptimisticLocking) {
+		return permanentFailure
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == "40001", // serialization_failure
+			pqErr.Code == "40P01", // deadlock_detected
+			pqErr.Code == "53300", // too_many_connections
+			pqErr.Code == "57P03", // cannot_connect_now
+			pqErr.Code == "08001", // sqlclient_unable_to_establish_sqlconnection
+			pqErr.Code == "08004": // sqlserver_rejected_establishment_of_sqlconnection
+			return abortedFailure
+		case pqErr.Code.Class() == "08", // connection_exception
+			pqErr.Code == "57P01", // admin_shutdown
+			pqErr.Code == "57P02": // crash_shutdown
+			return transientFailure
+		default:
+			return permanentFailure
+		}
+	}
+
+	if errors.Is(err, sqldriver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED) {
+		return abortedFailure
+	}
+
+	var netErr net.Error
+	if errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr) {
+		return transientFailure
+	}
+
+	return permanentFailure
+}
@@ -0,0 +1,250 @@
+package es_test
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/suite"
+)
+
+type ResilientDriverSuite struct {
+	suite.Suite
+}
+
+func TestResilientDriverSuite(t *testing.T) {
+	suite.Run(t, new(ResilientDriverSuite))
+}
+
+func (s *ResilientDriverSuite) TestRetriesTransientReadFailures() {
+	driver := &FlakyDriver{Driver: es.NewInMemoryDriver(), Errors: []error{io.ErrUnexpectedEOF, &pq.Error{Code: "57P01"}}}
+	err := driver.Driver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	resilientDriver := es.NewResilientDriver(driver, es.WithResilientRetries(3, time.Millisecond, time.Millisecond))
+	events, err := resilientDriver.Load("123")
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+	s.Equal(3, driver.Calls)
+
+	driver.Errors = []error{io.EOF}
+	events, err = resilientDriver.ReadEventsOfTypes(0, 1, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+	s.Equal(5, driver.Calls)
+}
+
+func (s *ResilientDriverSuite) TestGivesUpAfterMaxAttempts() {
+	driver := &FlakyDriver{Driver: es.NewInMemoryDriver(), Errors: []error{io.EOF, io.EOF, io.EOF}}
+	resilientDriver := es.NewResilientDriver(driver, es.WithResilientRetries(2, time.Millisecond, time.Millisecond))
+
+	_, err := resilientDriver.Load("123")
+	s.Equal(io.EOF, err)
+	s.Equal(2, driver.Calls)
+}
+
+func (s *ResilientDriverSuite) TestRetriesSavesAbortedBeforeCommit() {
+	driver := &FlakyDriver{Driver: es.NewInMemoryDriver(), Errors: []error{&pq.Error{Code: "40001"}, &pq.Error{Code: "40P01"}}}
+	resilientDriver := es.NewResilientDriver(driver, es.WithResilientRetries(3, time.Millisecond, time.Millisecond))
+
+	err := resilientDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+	s.Equal(3, driver.Calls)
+	s.Equal(1, len(driver.Driver.Stream()))
+}
+
+func (s *ResilientDriverSuite) TestDoesNotRetrySavesWithUnknownOutcome() {
+	driver := &FlakyDriver{Driver: es.NewInMemoryDriver(), Errors: []error{io.ErrUnexpectedEOF}}
+	resilientDriver := es.NewResilientDriver(driver, es.WithResilientRetries(3, time.Millisecond, time.Millisecond))
+
+	err := resilientDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.Equal(io.ErrUnexpectedEOF, err)
+	s.Equal(1, driver.Calls)
+}
+
+func (s *ResilientDriverSuite) TestNeverRetriesOptimisticLockingViolations() {
+	driver := &FlakyDriver{Driver: es.NewInMemoryDriver()}
+	resilientDriver := es.NewResilientDriver(driver, es.WithResilientRetries(3, time.Millisecond, time.Millisecond))
+
+	err := resilientDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+	err = resilientDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+	s.Equal(2, driver.Calls)
+}
+
+func (s *ResilientDriverSuite) TestDoesNotRetryPermanentFailures() {
+	driver := &FlakyDriver{Driver: es.NewInMemoryDriver(), Errors: []error{&pq.Error{Code: "42P01"}}}
+	resilientDriver := es.NewResilientDriver(driver, es.WithResilientRetries(3, time.Millisecond, time.Millisecond))
+
+	_, err := resilientDriver.Load("123")
+	s.Error(err)
+	s.Equal(1, driver.Calls)
+}
+
+func (s *ResilientDriverSuite) TestOpensCircuitUnderSustainedFailures() {
+	driver := &FlakyDriver{Driver: es.NewInMemoryDriver(), Errors: []error{io.EOF, io.EOF, io.EOF, io.EOF}}
+	resilientDriver := es.NewResilientDriver(
+		driver,
+		es.WithResilientRetries(2, time.Millisecond, time.Millisecond),
+		es.WithResilientBreaker(3, 50*time.Millisecond),
+	)
+
+	_, err := resilientDriver.Load("123")
+	s.Equal(io.EOF, err)
+	_, err = resilientDriver.Load("123")
+	s.Equal(io.EOF, err, "Circuit opened on the third failure, returning it")
+	s.Equal(3, driver.Calls)
+
+	_, err = resilientDriver.Load("123")
+	s.Equal(es.ErrCircuitOpen, err)
+	s.Equal(3, driver.Calls, "Open circuit fails fast")
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = resilientDriver.Load("123")
+	s.Equal(io.EOF, err, "Trial call failed and reopened the circuit")
+	s.Equal(4, driver.Calls)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = resilientDriver.Load("123")
+	s.NoError(err, "Trial call succeeded and closed the circuit")
+	_, err = resilientDriver.Load("123")
+	s.NoError(err)
+	s.Equal(6, driver.Calls)
+}
+
+// FlakyDriver fails with the given errors before delegating to the internal
+// driver
+type FlakyDriver struct {
+	Driver *es.InMemoryDriver
+	Errors []error
+	Calls  int
+}
+
+func (d *FlakyDriver) Load(aggregateID string) ([]*es.Event, error) {
+	if err := d.fail(); err != nil {
+		return nil, err
+	}
+	return d.Driver.Load(aggregateID)
+}
+
+func (d *FlakyDriver) Save(events []*es.Event) error {
+	if err := d.fail(); err != nil {
+		return err
+	}
+	return d.Driver.Save(events)
+}
+
+func (d *FlakyDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*es.Event, error) {
+	if err := d.fail(); err != nil {
+		return nil, err
+	}
+	return d.Driver.ReadEventsOfTypes(position, count, types)
+}
+
+func (d *FlakyDriver) fail() error {
+	d.Calls++
+	if len(d.Errors) == 0 {
+		return nil
+	}
+	err := d.Errors[0]
+	d.Errors = d.Errors[1:]
+	return err
+}
+
+func (s *ResilientDriverSuite) TestRetriesWhenRollbackFailsOnBrokenConnection() {
+	connector := &brokenConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	resilientDriver := es.NewResilientDriver(
+		es.NewPostgresDriver(db, es.WithPostgresRowLevelSecurity()),
+		es.WithResilientRetries(3, time.Millisecond, time.Millisecond),
+		es.WithResilientBreaker(10, time.Second),
+	)
+
+	err := resilientDriver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.True(errors.Is(err, syscall.ECONNREFUSED))
+	s.Equal(3, connector.transactions)
+
+	_, err = resilientDriver.LoadContext(es.WithTenant(context.Background(), "tenant-a"), "123")
+	s.True(errors.Is(err, syscall.ECONNREFUSED))
+	s.Equal(6, connector.transactions)
+}
+
+// brokenConnector connects to a database whose connections break once a
+// transaction begins, failing every statement and rollback
+type brokenConnector struct {
+	transactions int
+}
+
+func (c *brokenConnector) Connect(context.Context) (sqldriver.Conn, error) {
+	return &brokenConn{connector: c}, nil
+}
+
+func (c *brokenConnector) Driver() sqldriver.Driver {
+	return nil
+}
+
+type brokenConn struct {
+	connector *brokenConnector
+}
+
+func (c *brokenConn) Prepare(string) (sqldriver.Stmt, error) {
+	return brokenStmt{}, nil
+}
+
+func (c *brokenConn) Close() error {
+	return nil
+}
+
+func (c *brokenConn) Begin() (sqldriver.Tx, error) {
+	return c.BeginTx(context.Background(), sqldriver.TxOptions{})
+}
+
+func (c *brokenConn) BeginTx(context.Context, sqldriver.TxOptions) (sqldriver.Tx, error) {
+	c.connector.transactions++
+	return brokenTx{}, nil
+}
+
+type brokenStmt struct{}
+
+func (brokenStmt) Close() error {
+	return nil
+}
+
+func (brokenStmt) NumInput() int {
+	return -1
+}
+
+func (brokenStmt) Exec([]sqldriver.Value) (sqldriver.Result, error) {
+	return nil, syscall.ECONNREFUSED
+}
+
+func (brokenStmt) Query([]sqldriver.Value) (sqldriver.Rows, error) {
+	return nil, syscall.ECONNREFUSED
+}
+
+type brokenTx struct{}
+
+func (brokenTx) Commit() error {
+	return syscall.ECONNREFUSED
+}
+
+func (brokenTx) Rollback() error {
+	return syscall.ECONNREFUSED
+}
+
+func TestResilientDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		return es.NewResilientDriver(es.NewInMemoryDriver()), nil
+	})
+}
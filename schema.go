@@ -0,0 +1,501 @@
+package es
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// schemaDialect is the JSON Schema version of generated schemas
+const schemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// VersionedPayload is optionally implemented by payloads whose contract is
+// versioned, the version being stated by their schema
+type VersionedPayload interface {
+	PayloadVersion() int
+}
+
+// Schema is a JSON Schema describing the encoding of a payload
+type Schema struct {
+	Dialect              string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 SchemaType         `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	AggregateType        string             `json:"x-aggregateType,omitempty"`
+	Version              int                `json:"x-version,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+
+	// Kept for introspection: the Go type described, and the order in which
+	// properties are declared
+	goType string
+	order  []string
+}
+
+// SchemaType lists the JSON types a schema allows, encoded as a single type
+// when there is only one
+type SchemaType []string
+
+// MarshalJSON implements `json.Marshaler`
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// SchemaDriftHook is called with every loaded event whose payload doesn't
+// match the schema of its type, in strict mode
+type SchemaDriftHook func(event *Event, errs []error)
+
+// SetStrictSchemas sets whether the encoded payloads of saved events are
+// validated against the schema of their type, and loaded ones checked for
+// drift from it. Defaults to false.
+func (r *Registry) SetStrictSchemas(strict bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.strict = strict
+}
+
+// OnSchemaDrift adds a hook reporting loaded events whose payload doesn't
+// match the schema of their type, in strict mode. Drift is logged as a
+// warning when there are no hooks.
+func (r *Registry) OnSchemaDrift(hook SchemaDriftHook) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.driftHooks = append(r.driftHooks, hook)
+}
+
+// Schema returns the schema of the payload registered with the given name.
+// It's shared, so it must not be modified.
+func (r *Registry) Schema(name string) (*Schema, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	schema, ok := r.schemas[name]
+	if !ok {
+		return nil, fmt.Errorf("No type registered for '%s'", name)
+	}
+	return schema, nil
+}
+
+// Schemas returns the schemas of every registered payload by name. They're
+// shared, so they must not be modified.
+func (r *Registry) Schemas() map[string]*Schema {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	schemas := map[string]*Schema{}
+	for name, schema := range r.schemas {
+		schemas[name] = schema
+	}
+	return schemas
+}
+
+// unsafeFileCharacters matches what isn't kept of payload names in file names
+var unsafeFileCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// ExportSchemas writes the schema of every registered payload to the given
+// directory, creating it when missing, as `<name>.schema.json`, or
+// `<name>.v<version>.schema.json` for versioned payloads
+func (r *Registry) ExportSchemas(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for name, schema := range r.Schemas() {
+		data, err := json.MarshalIndent(schema, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		file := unsafeFileCharacters.ReplaceAllString(name, "_")
+		if schema.Version != 0 {
+			file = fmt.Sprintf("%s.v%d", file, schema.Version)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, file+".schema.json"), append(data, '\n'), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSchema checks the encoding of the given payload against the schema
+// of its type, in strict mode
+func (r *Registry) validateSchema(name string, payload interface{}) []error {
+	r.mutex.RLock()
+	schema, strict := r.schemas[name], r.strict
+	r.mutex.RUnlock()
+	if !strict || schema == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return []error{err}
+	}
+	return schema.Validate(data)
+}
+
+// reportDrift passes the given schema errors of a loaded event to the given
+// hooks, or logs them when there are none
+func reportDrift(event *Event, errs []error, hooks []SchemaDriftHook) {
+	if len(errs) == 0 {
+		return
+	}
+	if len(hooks) == 0 {
+		log.
+			Warn().
+			Errs("Errors", errs).
+			Str("EventID", event.ID).
+			Str("EventType", event.Type).
+			Msg("Payload drifted from schema")
+
+		return
+	}
+
+	for _, hook := range hooks {
+		hook(event, errs)
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// generateSchema describes the JSON encoding of the given payload, following
+// the rules of `encoding/json`. Named structs are defined once under `$defs`,
+// so recursive payloads are described too.
+func generateSchema(payload EventPayload) *Schema {
+	t := reflect.TypeOf(payload)
+	g := &schemaGenerator{root: t, defs: map[string]*Schema{}}
+
+	schema := g.schemaOf(t)
+	if t.Kind() == reflect.Struct {
+		schema = g.structSchema(t)
+	}
+	schema.goType = t.String()
+	schema.Dialect = schemaDialect
+	schema.ID = payload.PayloadType()
+	schema.Title = payload.PayloadType()
+	schema.AggregateType = payload.AggregateType()
+	if versioned, ok := payload.(VersionedPayload); ok {
+		schema.Version = versioned.PayloadVersion()
+		schema.ID = fmt.Sprintf("%s/v%d", schema.ID, schema.Version)
+	}
+	if len(g.defs) > 0 {
+		schema.Defs = g.defs
+	}
+	return schema
+}
+
+type schemaGenerator struct {
+	root reflect.Type
+	defs map[string]*Schema
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: SchemaType{"string"}, Format: "date-time"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		return &Schema{}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: SchemaType{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: SchemaType{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: SchemaType{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaType{"number"}}
+	case reflect.String:
+		return &Schema{Type: SchemaType{"string"}}
+	case reflect.Ptr:
+		return nullable(g.schemaOf(t.Elem()))
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: SchemaType{"string", "null"}, ContentEncoding: "base64"}
+		}
+		return &Schema{Type: SchemaType{"array", "null"}, Items: g.schemaOf(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: SchemaType{"array"}, Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: SchemaType{"object", "null"}, AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t == g.root {
+			return &Schema{Ref: "#"}
+		}
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+
+		name := t.String()
+		if _, ok := g.defs[name]; !ok {
+			// Defined before being generated, for recursive fields to refer to it
+			def := &Schema{}
+			g.defs[name] = def
+			*def = *g.structSchema(t)
+		}
+		return &Schema{Ref: "#/$defs/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)}
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema describes the fields of the given struct, those of embedded
+// structs being promoted unless shadowed
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:                 SchemaType{"object"},
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+	required := map[string]bool{}
+	var names []string
+	add := func(name string, property *Schema, isRequired bool, promoted bool) {
+		if _, ok := schema.Properties[name]; ok && promoted {
+			return
+		}
+		if _, ok := schema.Properties[name]; !ok {
+			names = append(names, name)
+		}
+		schema.Properties[name] = property
+		required[name] = isRequired
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			embedded := fieldType
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				promoted := g.structSchema(embedded)
+				for _, promotedName := range promoted.order {
+					isRequired := fieldType.Kind() != reflect.Ptr && contains(promoted.Required, promotedName)
+					add(promotedName, promoted.Properties[promotedName], isRequired, true)
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schemaOf(fieldType)
+		if hasOption(options, "string") && isScalar(fieldType) {
+			property = &Schema{Type: SchemaType{"string"}}
+		}
+		property.goType = fieldType.String()
+		add(name, property, !hasOption(options, "omitempty"), false)
+	}
+
+	schema.goType = t.String()
+	schema.order = names
+	for _, name := range names {
+		if required[name] {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	if len(schema.Properties) == 0 {
+		schema.Properties = nil
+	}
+	return schema
+}
+
+// nullable allows null besides what the given schema allows
+func nullable(schema *Schema) *Schema {
+	switch {
+	case schema.Ref != "":
+		return &Schema{AnyOf: []*Schema{schema, {Type: SchemaType{"null"}}}}
+	case len(schema.Type) == 0 || contains(schema.Type, "null"):
+		return schema
+	}
+
+	copied := *schema
+	copied.Type = append(append(SchemaType{}, schema.Type...), "null")
+	return &copied
+}
+
+func isScalar(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func hasOption(options string, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the given JSON against the schema, returning every
+// mismatch found
+func (s *Schema) Validate(data []byte) []error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return []error{err}
+	}
+
+	return s.validate(s, value, "payload")
+}
+
+// validate checks the given value against the given schema, resolving
+// references against the receiver
+func (s *Schema) validate(schema *Schema, value interface{}, path string) []error {
+	if schema.Ref != "" {
+		target := s.resolve(schema.Ref)
+		if target == nil {
+			return []error{fmt.Errorf("%s: unresolved reference '%s'", path, schema.Ref)}
+		}
+		return s.validate(target, value, path)
+	}
+	if len(schema.AnyOf) > 0 {
+		for _, option := range schema.AnyOf {
+			if len(s.validate(option, value, path)) == 0 {
+				return nil
+			}
+		}
+		return []error{fmt.Errorf("%s: matches none of the allowed schemas", path)}
+	}
+
+	actual := jsonType(value)
+	if len(schema.Type) > 0 && !contains(schema.Type, actual) && !(actual == "integer" && contains(schema.Type, "number")) {
+		return []error{fmt.Errorf("%s: expected %s, got %s", path, strings.Join(schema.Type, " or "), actual)}
+	}
+
+	var errs []error
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing property '%s'", path, name))
+			}
+		}
+
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := schema.Properties[name]; ok {
+				errs = append(errs, s.validate(property, value[name], path+"."+name)...)
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					errs = append(errs, fmt.Errorf("%s: unexpected property '%s'", path, name))
+				}
+			case *Schema:
+				errs = append(errs, s.validate(additional, value[name], path+"."+name)...)
+			}
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range value {
+				errs = append(errs, s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return errs
+}
+
+// resolve returns the schema the given reference points to within the
+// receiver, or nil when there is none
+func (s *Schema) resolve(ref string) *Schema {
+	if ref == "#" {
+		return s
+	}
+	name := strings.TrimPrefix(ref, "#/$defs/")
+	if name == ref {
+		return nil
+	}
+	return s.Defs[strings.NewReplacer("~1", "/", "~0", "~").Replace(name)]
+}
+
+// jsonType names the JSON type of the given decoded value
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(value.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
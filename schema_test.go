@@ -0,0 +1,235 @@
+package es_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/stretchr/testify/suite"
+)
+
+type SchemaSuite struct {
+	suite.Suite
+	registry *es.Registry
+}
+
+func TestSchemaSuite(t *testing.T) {
+	suite.Run(t, new(SchemaSuite))
+}
+
+// Address is a named struct shared by payloads
+type Address struct {
+	City string
+}
+
+// Audit is embedded by payloads
+type Audit struct {
+	By string `json:"by"`
+}
+
+// Registered event sample covering the encoding rules
+type Registered struct {
+	Audit
+	Name     string          `json:"name"`
+	Nickname string          `json:"nickname,omitempty"`
+	Age      int             `json:",string"`
+	Score    float64         `json:"score"`
+	Active   bool            `json:"active"`
+	Tags     []string        `json:"tags"`
+	Labels   map[string]int  `json:"labels"`
+	Address  *Address        `json:"address"`
+	Previous []Address       `json:"previous"`
+	Referrer *Registered     `json:"referrer,omitempty"`
+	Joined   time.Time       `json:"joined"`
+	Extra    json.RawMessage `json:"extra"`
+	Ignored  string          `json:"-"`
+	internal string
+}
+
+func (Registered) PayloadType() string {
+	return "Registered"
+}
+
+func (Registered) AggregateType() string {
+	return "Member"
+}
+
+func (Registered) PayloadVersion() int {
+	return 2
+}
+
+// Renamed event sample whose encoding drifts from its fields
+type Renamed struct {
+	Name string
+}
+
+func (Renamed) PayloadType() string {
+	return "Renamed"
+}
+
+func (Renamed) AggregateType() string {
+	return "Member"
+}
+
+func (r Renamed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"Name": r.Name, "Legacy": r.Name})
+}
+
+// driftedHappened is encoded like SomethingHappened with an extra field
+type driftedHappened struct {
+	Data  string
+	Extra int
+}
+
+func (driftedHappened) PayloadType() string {
+	return "SomethingHappened"
+}
+
+func (driftedHappened) AggregateType() string {
+	return "SampleAggregate"
+}
+
+func (s *SchemaSuite) SetupTest() {
+	s.registry = es.NewRegistry()
+	s.Require().NoError(s.registry.Register(Registered{}))
+	s.Require().NoError(s.registry.Register(Renamed{}))
+	s.Require().NoError(s.registry.Register(SomethingHappened{}))
+}
+
+func (s *SchemaSuite) TestGeneratesSchema() {
+	schema, err := s.registry.Schema("Registered")
+	s.Require().NoError(err)
+
+	data, err := json.Marshal(schema)
+	s.NoError(err)
+	s.JSONEq(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "Registered/v2",
+		"title": "Registered",
+		"x-aggregateType": "Member",
+		"x-version": 2,
+		"type": "object",
+		"properties": {
+			"by": {"type": "string"},
+			"name": {"type": "string"},
+			"nickname": {"type": "string"},
+			"Age": {"type": "string"},
+			"score": {"type": "number"},
+			"active": {"type": "boolean"},
+			"tags": {"type": ["array", "null"], "items": {"type": "string"}},
+			"labels": {"type": ["object", "null"], "additionalProperties": {"type": "integer"}},
+			"address": {"anyOf": [{"$ref": "#/$defs/es_test.Address"}, {"type": "null"}]},
+			"previous": {"type": ["array", "null"], "items": {"$ref": "#/$defs/es_test.Address"}},
+			"referrer": {"anyOf": [{"$ref": "#"}, {"type": "null"}]},
+			"joined": {"type": "string", "format": "date-time"},
+			"extra": {}
+		},
+		"required": ["by", "name", "Age", "score", "active", "tags", "labels", "address", "previous", "joined", "extra"],
+		"additionalProperties": false,
+		"$defs": {
+			"es_test.Address": {
+				"type": "object",
+				"properties": {"City": {"type": "string"}},
+				"required": ["City"],
+				"additionalProperties": false
+			}
+		}
+	}`, string(data))
+
+	_, err = s.registry.Schema("Unregistered")
+	s.EqualError(err, "No type registered for 'Unregistered'")
+	s.Equal(3, len(s.registry.Schemas()))
+}
+
+func (s *SchemaSuite) TestValidatesAgainstSchema() {
+	schema, err := s.registry.Schema("Registered")
+	s.Require().NoError(err)
+
+	payload, err := json.Marshal(&Registered{Name: "Marty", Address: &Address{City: "Hill Valley"}, Referrer: &Registered{}})
+	s.NoError(err)
+	s.Empty(schema.Validate(payload))
+
+	errs := schema.Validate([]byte(`{"by": "", "name": 1, "Age": "17", "score": 1, "active": true, "tags": null, "labels": {"a": "b"}, "address": {}, "previous": [{"City": 1}], "joined": "", "extra": null, "unknown": 0}`))
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	s.Equal([]string{
+		"payload.address: matches none of the allowed schemas",
+		"payload.labels.a: expected integer, got string",
+		"payload.name: expected string, got integer",
+		"payload.previous[0].City: expected string, got integer",
+		"payload: unexpected property 'unknown'",
+	}, messages)
+}
+
+func (s *SchemaSuite) TestExportsSchemas() {
+	dir, err := ioutil.TempDir("", "schemas")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	err = s.registry.ExportSchemas(filepath.Join(dir, "contracts"))
+	s.NoError(err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "contracts", "*"))
+	s.NoError(err)
+	s.Equal([]string{
+		filepath.Join(dir, "contracts", "Registered.v2.schema.json"),
+		filepath.Join(dir, "contracts", "Renamed.schema.json"),
+		filepath.Join(dir, "contracts", "SomethingHappened.schema.json"),
+	}, files)
+
+	data, err := ioutil.ReadFile(files[2])
+	s.NoError(err)
+	s.JSONEq(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "SomethingHappened",
+		"title": "SomethingHappened",
+		"x-aggregateType": "SampleAggregate",
+		"type": "object",
+		"properties": {"Data": {"type": "string"}},
+		"required": ["Data"],
+		"additionalProperties": false
+	}`, string(data))
+}
+
+func (s *SchemaSuite) TestStrictSaveRejectsPayloadsNotMatchingSchema() {
+	store := es.NewStore(es.NewInMemoryDriver(), es.WithStoreRegistry(s.registry))
+	aggregate := &SampleAggregate{}
+	events := aggregate.Apply(aggregate, []*es.Event{es.NewEvent("1", &Renamed{Name: "Doc"})})
+
+	s.registry.SetStrictSchemas(true)
+	err := store.Save(events)
+	var validationErr *es.ValidationError
+	s.Require().True(errors.As(err, &validationErr))
+	s.EqualError(validationErr.Events[0].Errors[0], "payload: unexpected property 'Legacy'")
+
+	s.registry.SetStrictSchemas(false)
+	err = store.Save(events)
+	s.NoError(err)
+}
+
+func (s *SchemaSuite) TestStrictLoadReportsDrift() {
+	driver := es.NewInMemoryDriver(es.WithInMemoryRegistry(s.registry))
+	event := es.NewEvent("1", &driftedHappened{Data: "data", Extra: 1})
+	event.AggregateVersion = 1
+	s.Require().NoError(driver.Save([]*es.Event{event}))
+
+	var drifted []string
+	s.registry.SetStrictSchemas(true)
+	s.registry.OnSchemaDrift(func(event *es.Event, errs []error) {
+		for _, err := range errs {
+			drifted = append(drifted, event.AggregateID+": "+err.Error())
+		}
+	})
+
+	events, err := driver.Load("1")
+	s.NoError(err)
+	s.Equal(&SomethingHappened{Data: "data"}, events[0].Payload, "Drift is reported, not failed")
+	s.Equal([]string{"1: payload: unexpected property 'Extra'"}, drifted)
+}
@@ -0,0 +1,341 @@
+package es
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ErrShardedPosition is returned when reading events of a ShardedDriver from
+// a single position, which is meaningless across shards
+var ErrShardedPosition = errors.New("sharded reads resume from a ShardCursor")
+
+// ShardCursor holds the position reached on every shard by name. Shards
+// missing from it are read from the start.
+type ShardCursor map[string]int64
+
+// ShardedOption configures a ShardedDriver
+type ShardedOption func(*ShardedDriver)
+
+// WithShardVirtualNodes sets how many points every shard gets on the hash
+// ring. More points spread aggregates more evenly. Defaults to 128.
+func WithShardVirtualNodes(nodes int) ShardedOption {
+	return func(d *ShardedDriver) {
+		d.nodes = nodes
+	}
+}
+
+// NewShardedDriver creates a new ShardedDriver with the given shards by name.
+// Names place shards on the hash ring, so they must stay the same across
+// deployments.
+func NewShardedDriver(shards map[string]Driver, options ...ShardedOption) *ShardedDriver {
+	d := &ShardedDriver{
+		Shards: shards,
+		nodes:  128,
+	}
+	for _, option := range options {
+		option(d)
+	}
+
+	for name := range shards {
+		for i := 0; i < d.nodes; i++ {
+			d.ring = append(d.ring, ringPoint{hash: hashKey(name + "#" + strconv.Itoa(i)), shard: name})
+		}
+	}
+	sort.Slice(d.ring, func(i, j int) bool {
+		if d.ring[i].hash == d.ring[j].hash {
+			return d.ring[i].shard < d.ring[j].shard
+		}
+		return d.ring[i].hash < d.ring[j].hash
+	})
+	return d
+}
+
+// ShardedDriver implementation spreading aggregates over several drivers by
+// consistent hashing of their IDs, so that adding a shard only moves the
+// streams it takes over. Saves of events spanning several shards are only
+// transactional per shard.
+type ShardedDriver struct {
+	Shards map[string]Driver
+	nodes  int
+	ring   []ringPoint
+}
+
+type ringPoint struct {
+	hash  uint64
+	shard string
+}
+
+// ShardFor returns the name of the shard owning the given aggregate
+func (d *ShardedDriver) ShardFor(aggregateID string) string {
+	if len(d.ring) == 0 {
+		return ""
+	}
+
+	hash := hashKey(aggregateID)
+	i := sort.Search(len(d.ring), func(i int) bool {
+		return d.ring[i].hash >= hash
+	})
+	if i == len(d.ring) {
+		i = 0
+	}
+	return d.ring[i].shard
+}
+
+// shard returns the shard owning the given aggregate
+func (d *ShardedDriver) shard(aggregateID string) (Driver, error) {
+	shard, ok := d.Shards[d.ShardFor(aggregateID)]
+	if !ok {
+		return nil, fmt.Errorf("no shard for aggregate '%s'", aggregateID)
+	}
+	return shard, nil
+}
+
+// Load loads events from the shard owning the aggregate
+func (d *ShardedDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (d *ShardedDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	shard, err := d.shard(aggregateID)
+	if err != nil {
+		return nil, err
+	}
+	return loadContext(ctx, shard, aggregateID)
+}
+
+// Save saves events to the shards owning their aggregates
+func (d *ShardedDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (d *ShardedDriver) SaveContext(ctx context.Context, events []*Event) error {
+	var names []string
+	batches := map[string][]*Event{}
+	for _, event := range events {
+		name := d.ShardFor(event.AggregateID)
+		if _, ok := batches[name]; !ok {
+			names = append(names, name)
+		}
+		batches[name] = append(batches[name], event)
+	}
+
+	for _, name := range names {
+		shard, err := d.shard(batches[name][0].AggregateID)
+		if err != nil {
+			return err
+		}
+		err = saveContext(ctx, shard, batches[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadEventsOfTypes reads events from the start of every shard. Reading from
+// any other position fails with `ErrShardedPosition`, use
+// `ReadEventsOfTypesAfter` instead, unless there is a single shard whose
+// positions are used as they are.
+func (d *ShardedDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *ShardedDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	if len(d.Shards) == 1 {
+		for _, shard := range d.Shards {
+			return readEventsOfTypesContext(ctx, shard, position, count, types)
+		}
+	}
+	if position != 0 {
+		return nil, ErrShardedPosition
+	}
+
+	events, _, err := d.ReadEventsOfTypesAfter(ctx, ShardCursor{}, count, types)
+	return events, err
+}
+
+// ReadEventsOfTypesAfter reads events of the given types after the cursor
+// from every shard, merged by creation time, and returns the cursor to
+// resume from. Events keep the positions of their shards.
+func (d *ShardedDriver) ReadEventsOfTypesAfter(ctx context.Context, cursor ShardCursor, count uint, types []string) ([]*Event, ShardCursor, error) {
+	heads := make([]*shardHead, 0, len(d.Shards))
+	errs := make([]error, 0, len(d.Shards))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for name, shard := range d.Shards {
+		wg.Add(1)
+		go func(name string, shard Driver) {
+			defer wg.Done()
+			events, err := readEventsOfTypesContext(ctx, shard, cursor[name], count, types)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("shard '%s': %w", name, err))
+				return
+			}
+			heads = append(heads, &shardHead{shard: name, events: events})
+		}(name, shard)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+
+	next := ShardCursor{}
+	for name, position := range cursor {
+		next[name] = position
+	}
+
+	var merged []*Event
+	for uint(len(merged)) < count {
+		var earliest *shardHead
+		for _, head := range heads {
+			if len(head.events) > 0 && (earliest == nil || head.before(earliest)) {
+				earliest = head
+			}
+		}
+		if earliest == nil {
+			break
+		}
+
+		event := earliest.events[0]
+		next[earliest.shard] = event.Position
+		earliest.events = earliest.events[1:]
+		merged = append(merged, event)
+	}
+
+	return merged, next, nil
+}
+
+// Rebalance moves the streams having events of the given types to the shard
+// now owning them, such as after adding a shard. It must run before writes
+// go through the new shards, and needs every shard to implement
+// `StreamRemover`. Shards are scanned by batches of the given size, scoped to
+// the context tenant. Returns how many streams were moved. Streams are only
+// found by their events of the given types, so streams having none of them
+// stay on the shard they were saved to.
+//
+// Moved events keep their IDs and creation times, whatever clock the shards
+// or the context have, but take new positions on the shard they're moved to.
+// Consumers resuming from a `ShardCursor`, such as projections, see them
+// again.
+func (d *ShardedDriver) Rebalance(ctx context.Context, types []string, batch uint) (int, error) {
+	names := make([]string, 0, len(d.Shards))
+	for name, shard := range d.Shards {
+		if _, ok := shard.(StreamRemover); !ok {
+			return 0, fmt.Errorf("shard '%s' can't remove streams", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	moved := 0
+	for _, name := range names {
+		misplaced, err := d.misplaced(ctx, name, types, batch)
+		if err != nil {
+			return moved, err
+		}
+
+		for _, aggregateID := range misplaced {
+			err := d.move(ctx, name, aggregateID)
+			if err != nil {
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// misplaced scans the given shard for aggregates owned by another shard
+func (d *ShardedDriver) misplaced(ctx context.Context, name string, types []string, batch uint) ([]string, error) {
+	seen := map[string]bool{}
+	var misplaced []string
+	var position int64
+	for {
+		events, err := readEventsOfTypesContext(ctx, d.Shards[name], position, batch, types)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			return misplaced, nil
+		}
+
+		for _, event := range events {
+			if !seen[event.AggregateID] && d.ShardFor(event.AggregateID) != name {
+				misplaced = append(misplaced, event.AggregateID)
+			}
+			seen[event.AggregateID] = true
+		}
+
+		position = events[len(events)-1].Position
+	}
+}
+
+// move copies the stream of the given aggregate to the shard owning it before
+// removing it from the given shard, keeping the IDs and creation times of its
+// events. A stream already copied by an interrupted rebalance is only
+// removed.
+func (d *ShardedDriver) move(ctx context.Context, name string, aggregateID string) error {
+	source := d.Shards[name]
+	target := d.Shards[d.ShardFor(aggregateID)]
+
+	events, err := loadContext(ctx, source, aggregateID)
+	if err != nil {
+		return err
+	}
+
+	err = saveContext(keepCreated(ctx), target, events)
+	if errors.Is(err, ErrOptimisticLocking) {
+		copied, lErr := loadContext(ctx, target, aggregateID)
+		if lErr != nil {
+			return lErr
+		}
+		if len(copied) != len(events) {
+			return fmt.Errorf("stream '%s' partially moved to shard '%s': %w", aggregateID, d.ShardFor(aggregateID), err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return source.(StreamRemover).RemoveStream(ctx, aggregateID)
+}
+
+// shardHead holds the events read from a shard not merged yet
+type shardHead struct {
+	shard  string
+	events []*Event
+}
+
+// before tells whether the next event of the head was created before the one
+// of the other head, breaking ties by shard name
+func (h *shardHead) before(other *shardHead) bool {
+	created, otherCreated := h.events[0].Created, other.events[0].Created
+	if created.Equal(otherCreated) {
+		return h.shard < other.shard
+	}
+	return created.Before(otherCreated)
+}
+
+// hashKey hashes keys with FNV-1a, finalized like MurmurHash3 for similar
+// keys to spread over the ring
+func hashKey(key string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(key))
+	h := hash.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,199 @@
+package es_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/suite"
+)
+
+type ShardedDriverSuite struct {
+	suite.Suite
+}
+
+func TestShardedDriverSuite(t *testing.T) {
+	suite.Run(t, new(ShardedDriverSuite))
+}
+
+func (s *ShardedDriverSuite) TestRoutesAggregatesToOwningShard() {
+	shards := s.shards("a", "b", "c")
+	driver := es.NewShardedDriver(shards)
+
+	for i := 0; i < 9; i++ {
+		err := driver.Save([]*es.Event{es.NewEvent(fmt.Sprintf("uuid-%d", i), &SomethingHappened{Data: "1"})})
+		s.NoError(err)
+	}
+
+	for i := 0; i < 9; i++ {
+		aggregateID := fmt.Sprintf("uuid-%d", i)
+		events, err := driver.Load(aggregateID)
+		s.NoError(err)
+		s.Equal(1, len(events))
+
+		events, err = shards[driver.ShardFor(aggregateID)].Load(aggregateID)
+		s.NoError(err)
+		s.Equal(1, len(events), "Stored on the owning shard")
+	}
+}
+
+func (s *ShardedDriverSuite) TestSpreadsAggregatesEvenly() {
+	driver := es.NewShardedDriver(s.shards("a", "b", "c"))
+
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		counts[driver.ShardFor(fmt.Sprintf("uuid-%d", i))]++
+	}
+	for _, count := range counts {
+		s.InDelta(1000, count, 250)
+	}
+}
+
+func (s *ShardedDriverSuite) TestAddingShardOnlyMovesItsAggregates() {
+	before := es.NewShardedDriver(s.shards("a", "b", "c"))
+	after := es.NewShardedDriver(s.shards("a", "b", "c", "d"))
+
+	moved := 0
+	for i := 0; i < 4000; i++ {
+		aggregateID := fmt.Sprintf("uuid-%d", i)
+		if before.ShardFor(aggregateID) != after.ShardFor(aggregateID) {
+			s.Equal("d", after.ShardFor(aggregateID))
+			moved++
+		}
+	}
+	s.InDelta(1000, moved, 250)
+}
+
+func (s *ShardedDriverSuite) TestMergeReadsAcrossShards() {
+	driver := es.NewShardedDriver(s.shards("a", "b", "c"))
+	err := driver.Save(s.streams(6))
+	s.NoError(err)
+
+	read := map[string]int{}
+	cursor := es.ShardCursor{}
+	for {
+		events, next, err := driver.ReadEventsOfTypesAfter(context.Background(), cursor, 4, []string{"SomethingHappened"})
+		s.NoError(err)
+		if len(events) == 0 {
+			s.Equal(cursor, next)
+			break
+		}
+		s.True(len(events) <= 4)
+		for i := 1; i < len(events); i++ {
+			s.False(events[i].Created.Before(events[i-1].Created), "Merged by creation time")
+		}
+		for _, event := range events {
+			read[event.AggregateID+"/"+event.Payload.(*SomethingHappened).Data]++
+		}
+		cursor = next
+	}
+	s.Equal(12, len(read))
+	for _, count := range read {
+		s.Equal(1, count, "Read exactly once")
+	}
+
+	events, err := driver.ReadEventsOfTypes(0, 100, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(12, len(events))
+	_, err = driver.ReadEventsOfTypes(1, 100, []string{"SomethingHappened"})
+	s.Equal(es.ErrShardedPosition, err)
+}
+
+func (s *ShardedDriverSuite) TestRebalancesStreamsToAddedShard() {
+	shards := s.shards("a", "b")
+	err := es.NewShardedDriver(shards).Save(s.streams(4))
+	s.NoError(err)
+
+	shards["c"] = es.NewInMemoryDriver()
+	driver := es.NewShardedDriver(shards)
+	moved, err := driver.Rebalance(context.Background(), []string{"SomethingHappened"}, 3)
+	s.NoError(err)
+	s.True(moved > 0)
+	s.Equal(moved, len(shards["c"].(*es.InMemoryDriver).Stream())/2)
+
+	for i := 0; i < 4; i++ {
+		aggregateID := fmt.Sprintf("uuid-%d", i)
+		for name, shard := range shards {
+			events, err := shard.Load(aggregateID)
+			s.NoError(err)
+			if name == driver.ShardFor(aggregateID) {
+				s.Equal(2, len(events), "Moved to the owning shard")
+				s.Equal(int64(2), events[1].AggregateVersion)
+			} else {
+				s.Empty(events, "Removed from other shards")
+			}
+		}
+	}
+
+	moved, err = driver.Rebalance(context.Background(), []string{"SomethingHappened"}, 3)
+	s.NoError(err)
+	s.Equal(0, moved)
+}
+
+func (s *ShardedDriverSuite) TestRebalanceKeepsIDsAndCreationTimes() {
+	shards := s.shards("a", "b")
+	events := s.streams(4)
+	err := es.NewShardedDriver(shards).Save(events)
+	s.NoError(err)
+
+	shards["c"] = es.NewInMemoryDriver(es.WithInMemoryClock(es.FixedClock(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC))))
+	driver := es.NewShardedDriver(shards)
+	ctx := es.WithClock(context.Background(), es.SystemClock)
+	moved, err := driver.Rebalance(ctx, []string{"SomethingHappened"}, 3)
+	s.NoError(err)
+	s.True(moved > 0)
+
+	for _, event := range events {
+		loaded, err := driver.Load(event.AggregateID)
+		s.NoError(err)
+		s.Equal(event.ID, loaded[event.AggregateVersion-1].ID)
+		s.Equal(event.Created, loaded[event.AggregateVersion-1].Created)
+	}
+}
+
+func (s *ShardedDriverSuite) TestRebalanceNeedsRemovableStreams() {
+	driver := es.NewShardedDriver(map[string]es.Driver{"a": &BrokenDriver{}})
+	_, err := driver.Rebalance(context.Background(), []string{"SomethingHappened"}, 10)
+	s.EqualError(err, "shard 'a' can't remove streams")
+}
+
+func (s *ShardedDriverSuite) TestFailsWithoutShards() {
+	driver := es.NewShardedDriver(map[string]es.Driver{})
+	_, err := driver.Load("uuid-1")
+	s.EqualError(err, "no shard for aggregate 'uuid-1'")
+	err = driver.Save([]*es.Event{es.NewEvent("uuid-1", &SomethingHappened{})})
+	s.EqualError(err, "no shard for aggregate 'uuid-1'")
+}
+
+func (s *ShardedDriverSuite) shards(names ...string) map[string]es.Driver {
+	shards := map[string]es.Driver{}
+	for _, name := range names {
+		shards[name] = es.NewInMemoryDriver()
+	}
+	return shards
+}
+
+func (s *ShardedDriverSuite) streams(count int) []*es.Event {
+	var events []*es.Event
+	for i := 0; i < count; i++ {
+		for version := int64(1); version <= 2; version++ {
+			event := es.NewEvent(fmt.Sprintf("uuid-%d", i), &SomethingHappened{Data: fmt.Sprint(version)})
+			event.AggregateVersion = version
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestShardedDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		return es.NewShardedDriver(map[string]es.Driver{
+			"a": es.NewInMemoryDriver(),
+			"b": es.NewInMemoryDriver(),
+			"c": es.NewInMemoryDriver(),
+		}), nil
+	})
+}
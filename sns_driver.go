@@ -1,11 +1,14 @@
 package es
 
 import (
+	"context"
 	"encoding/json"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
 )
 
 // NewSNSDriver creates an SNSDriver
@@ -18,7 +21,7 @@ func NewSNSDriver(client *sns.SNS, topicArn string, driver Driver) *SNSDriver {
 }
 
 // SNSDriver creates a driver decorator that sends a notification to AWS' SNS
-// when new events are saved.
+// when new events are saved, listing their positions by type.
 type SNSDriver struct {
 	client   *sns.SNS
 	topicArn string
@@ -32,13 +35,24 @@ type snsMessage struct {
 
 // Load delegates to internal driver
 func (d *SNSDriver) Load(aggregateID string) ([]*Event, error) {
-	return d.driver.Load(aggregateID)
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (d *SNSDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	return loadContext(ctx, d.driver, aggregateID)
 }
 
 // Save delegates to internal driver. If successful, it'll emit a single
 // notification with all event types.
 func (d *SNSDriver) Save(events []*Event) error {
-	err := d.driver.Save(events)
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`. The trace context found in `ctx` is
+// injected in the message attributes through the global propagator.
+func (d *SNSDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := saveContext(ctx, d.driver, events)
 	if err != nil {
 		return err
 	}
@@ -67,15 +81,18 @@ func (d *SNSDriver) Save(events []*Event) error {
 		return nil
 	}
 
-	_, err = d.client.Publish(&sns.PublishInput{
-		TopicArn: aws.String(d.topicArn),
-		Message:  aws.String(string(eventIDsByType)),
-		MessageAttributes: map[string]*sns.MessageAttributeValue{
-			"EventTypes": {
-				DataType:    aws.String("String.Array"),
-				StringValue: aws.String(string(eventTypes)),
-			},
+	attributes := snsAttributesCarrier{
+		"EventTypes": {
+			DataType:    aws.String("String.Array"),
+			StringValue: aws.String(string(eventTypes)),
 		},
+	}
+	otel.GetTextMapPropagator().Inject(ctx, attributes)
+
+	_, err = d.client.Publish(&sns.PublishInput{
+		TopicArn:          aws.String(d.topicArn),
+		Message:           aws.String(string(eventIDsByType)),
+		MessageAttributes: attributes,
 	})
 	if err != nil {
 		log.
@@ -91,7 +108,12 @@ func (d *SNSDriver) Save(events []*Event) error {
 
 // ReadEventsOfTypes .
 func (d *SNSDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
-	return d.driver.ReadEventsOfTypes(position, count, types)
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *SNSDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	return readEventsOfTypesContext(ctx, d.driver, position, count, types)
 }
 
 func (d *SNSDriver) toSNSMessage(events []*Event) *snsMessage {
@@ -101,10 +123,38 @@ func (d *SNSDriver) toSNSMessage(events []*Event) *snsMessage {
 		if _, ok := idsByType[event.Type]; !ok {
 			types = append(types, event.Type)
 		}
-		idsByType[event.Type] = append(idsByType[event.Type], event.ID)
+		// Consumers read after positions, as they were the IDs of events
+		idsByType[event.Type] = append(idsByType[event.Type], strconv.FormatInt(event.Position, 10))
 	}
 	return &snsMessage{
 		eventTypes:     types,
 		eventIDsByType: idsByType,
 	}
 }
+
+// snsAttributesCarrier adapts SNS message attributes to
+// `propagation.TextMapCarrier`
+type snsAttributesCarrier map[string]*sns.MessageAttributeValue
+
+func (c snsAttributesCarrier) Get(key string) string {
+	attribute, ok := c[key]
+	if !ok || attribute.StringValue == nil {
+		return ""
+	}
+	return *attribute.StringValue
+}
+
+func (c snsAttributesCarrier) Set(key string, value string) {
+	c[key] = &sns.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+func (c snsAttributesCarrier) Keys() []string {
+	keys := []string{}
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -1,6 +1,7 @@
 package es_test
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -13,6 +14,9 @@ import (
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/indebted-modules/es"
 	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 type SNSNotifierSuite struct {
@@ -148,3 +152,31 @@ func (s *SNSNotifierSuite) TestDelegateReadEventsOfTypesToInternalDriver() {
 	s.NoError(err)
 	s.Equal(&SomethingHappened{}, events[0].Payload)
 }
+
+func (s *SNSNotifierSuite) TestPropagatesTraceContextInMessageAttributes() {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	tracer := sdktrace.NewTracerProvider().Tracer("es_test")
+	ctx, span := tracer.Start(context.Background(), "command")
+	defer span.End()
+
+	driver := es.NewSNSDriver(s.snsSvc, *s.topicArn, es.NewInMemoryDriver())
+	err := driver.SaveContext(ctx, []*es.Event{es.NewEvent("uuid-1", &SomethingHappened{})})
+	s.NoError(err)
+
+	response, err := s.sqsSvc.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:        s.queueURL,
+		WaitTimeSeconds: aws.Int64(1),
+	})
+	s.NoError(err)
+	s.Equal(1, len(response.Messages))
+
+	body := &struct {
+		MessageAttributes map[string]map[string]interface{}
+	}{}
+	err = json.Unmarshal([]byte(*response.Messages[0].Body), body)
+	s.NoError(err)
+	s.Equal("String", body.MessageAttributes["traceparent"]["Type"])
+	s.Contains(body.MessageAttributes["traceparent"]["Value"], span.SpanContext().TraceID().String())
+}
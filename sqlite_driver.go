@@ -0,0 +1,312 @@
+package es
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+)
+
+const createSQLiteTable = `
+	CREATE TABLE events (
+		ID               INTEGER PRIMARY KEY AUTOINCREMENT,
+		EventID          TEXT DEFAULT '' NOT NULL,
+		TenantID         TEXT DEFAULT '' NOT NULL,
+		Type             TEXT NOT NULL,
+		Created          TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')) NOT NULL,
+		AggregateID      TEXT NOT NULL,
+		AggregateVersion INTEGER NOT NULL,
+		AggregateType    TEXT NOT NULL,
+		Payload          TEXT NOT NULL,
+
+		CONSTRAINT OptimisticLocking UNIQUE (AggregateID, AggregateVersion, TenantID)
+	);
+
+	CREATE INDEX EventsTenant ON events (TenantID, ID);
+`
+
+// SQLiteOption configures a SQLiteDriver
+type SQLiteOption func(*SQLiteDriver)
+
+// WithSQLiteTenancy requires a tenant on every load, save and read
+func WithSQLiteTenancy() SQLiteOption {
+	return func(d *SQLiteDriver) {
+		d.multiTenant = true
+	}
+}
+
+// WithSQLiteClock sets the clock stamping saved events. Without it, events
+// created at no time are stamped by SQLite.
+func WithSQLiteClock(clock Clock) SQLiteOption {
+	return func(d *SQLiteDriver) {
+		d.clock = clock
+	}
+}
+
+// WithSQLiteRegistry sets the registry decoding loaded events
+func WithSQLiteRegistry(registry *Registry) SQLiteOption {
+	return func(d *SQLiteDriver) {
+		d.registry = registry
+	}
+}
+
+// NewSQLiteDriver creates a SQLiteDriver on the given database
+func NewSQLiteDriver(db *sql.DB, options ...SQLiteOption) *SQLiteDriver {
+	d := &SQLiteDriver{DB: db}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// SQLiteDriver implements a SQLite-backed event-store with the same schema
+// semantics as `PostgresDriver`. SQLite serializes writers, so positions are
+// always committed in order.
+type SQLiteDriver struct {
+	DB          *sql.DB
+	multiTenant bool
+	clock       Clock
+	registry    *Registry
+}
+
+// CreateTable creates the event-store table with the necessary columns and
+// constraints
+func (d *SQLiteDriver) CreateTable() error {
+	_, err := d.DB.Exec(createSQLiteTable)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Load loads all events for the given aggregateID ordered by version
+func (d *SQLiteDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext loads all events for the given aggregateID ordered by version,
+// scoped to the context tenant
+func (d *SQLiteDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryEvents(ctx, selectEvents+`
+		WHERE AggregateID = ? AND TenantID = ?
+		ORDER BY AggregateVersion
+	`, aggregateID, tenantID)
+}
+
+// LatestVersion returns the version of the latest event for the given
+// aggregateID, or zero when there are none, scoped to the context tenant
+func (d *SQLiteDriver) LatestVersion(ctx context.Context, aggregateID string) (int64, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int64
+	err = d.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(AggregateVersion), 0)
+		FROM events
+		WHERE AggregateID = ? AND TenantID = ?
+	`, aggregateID, tenantID).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// LoadAfter loads the events for the given aggregateID with a version greater
+// than the given one, ordered by version and scoped to the context tenant
+func (d *SQLiteDriver) LoadAfter(ctx context.Context, aggregateID string, version int64) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryEvents(ctx, selectEvents+`
+		WHERE AggregateID = ? AND AggregateVersion > ? AND TenantID = ?
+		ORDER BY AggregateVersion
+	`, aggregateID, version, tenantID)
+}
+
+// Save saves all given events in a single transaction, meaning that if any
+// of the events violates any constraints, none of the events will be
+// persisted
+func (d *SQLiteDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext saves all given events like `Save`, stamping them with the
+// context tenant
+func (d *SQLiteDriver) SaveContext(ctx context.Context, events []*Event) error {
+	err := stampTenant(ctx, events, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	clock := contextClock(ctx, d.clock)
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO events (
+			EventID,
+			TenantID,
+			Type,
+			AggregateID,
+			AggregateVersion,
+			AggregateType,
+			Payload,
+			Created
+		) VALUES(?, ?, ?, ?, ?, ?, ?, COALESCE(?, strftime('%Y-%m-%d %H:%M:%f', 'now')))
+	`)
+	if err != nil {
+		rollback(tx)
+		return err
+	}
+	defer ShouldClose(stmt)
+
+	positions := make([]int64, len(events))
+	for i, event := range events {
+		payload, err := event.marshalPayload()
+		if err != nil {
+			rollback(tx)
+			return err
+		}
+
+		// Without a clock or a creation time, the database tells the time
+		var created interface{}
+		if t := createdAt(event, clock, nil); !t.IsZero() {
+			created = t
+		}
+
+		result, err := stmt.ExecContext(
+			ctx,
+			event.ID,
+			event.TenantID,
+			event.Type,
+			event.AggregateID,
+			event.AggregateVersion,
+			event.AggregateType,
+			payload,
+			created,
+		)
+		if err != nil {
+			rollback(tx)
+			var sqliteErr sqlite3.Error
+			if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+				return &conflictError{err: err}
+			}
+			return err
+		}
+		positions[i], err = result.LastInsertId()
+		if err != nil {
+			rollback(tx)
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for i, event := range events {
+		event.Position = positions[i]
+	}
+	return nil
+}
+
+// RemoveStream deletes all events for the given aggregateID, scoped to the
+// context tenant
+func (d *SQLiteDriver) RemoveStream(ctx context.Context, aggregateID string) error {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.DB.ExecContext(ctx, `
+		DELETE FROM events
+		WHERE AggregateID = ? AND TenantID = ?
+	`, aggregateID, tenantID)
+	return err
+}
+
+// ReadEventsOfTypes .
+func (d *SQLiteDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext reads events of the given types after the given
+// position, scoped to the context tenant
+func (d *SQLiteDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	tenantID, err := contextTenant(ctx, d.multiTenant)
+	if err != nil {
+		return nil, err
+	}
+
+	types = contextRegistry(ctx, d.registry).readTypes(types)
+	typesJSON, err := json.Marshal(types)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.queryEvents(ctx, selectEvents+`
+		WHERE ID > ? AND
+		Type IN (SELECT value FROM json_each(?)) AND
+		TenantID = ?
+		ORDER BY ID
+		LIMIT ?
+	`, position, string(typesJSON), tenantID, count)
+}
+
+func (d *SQLiteDriver) queryEvents(ctx context.Context, query string, args ...interface{}) ([]*Event, error) {
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer ShouldClose(rows)
+
+	events, err := rowsToEvents(rows, contextRegistry(ctx, d.registry))
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// MustOpenSQLite ensures the SQLite database at the given path is opened in
+// WAL mode, letting reads go on while a save is being written. Panics
+// otherwise.
+func MustOpenSQLite(path string) *sql.DB {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		log.
+			Fatal().
+			Err(err).
+			Msg("Failed opening SQLite database")
+	}
+
+	var mode string
+	err = db.QueryRow(`PRAGMA journal_mode`).Scan(&mode)
+	if err != nil || mode != "wal" {
+		log.
+			Fatal().
+			Err(err).
+			Str("JournalMode", mode).
+			Msg("Failed enabling SQLite WAL mode")
+	}
+	db.SetConnMaxLifetime(time.Hour)
+	return db
+}
@@ -0,0 +1,257 @@
+package es_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type SQLiteDriverSuite struct {
+	suite.Suite
+	dir    string
+	db     *sql.DB
+	driver *es.SQLiteDriver
+}
+
+func TestSQLiteDriverSuite(t *testing.T) {
+	suite.Run(t, new(SQLiteDriverSuite))
+}
+
+func (s *SQLiteDriverSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "sqlite")
+	s.NoError(err)
+	s.dir = dir
+	s.db = es.MustOpenSQLite(filepath.Join(dir, "events.db"))
+
+	s.driver = &es.SQLiteDriver{DB: s.db}
+	err = s.driver.CreateTable()
+	s.NoError(err)
+}
+
+func (s *SQLiteDriverSuite) TearDownTest() {
+	err := s.db.Close()
+	s.NoError(err)
+	err = os.RemoveAll(s.dir)
+	s.NoError(err)
+}
+
+func (s *SQLiteDriverSuite) TestSaveAndLoad() {
+	err := s.driver.Save([]*es.Event{
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      "AggregateID#1",
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V1"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      "AggregateID#2",
+			AggregateVersion: 1,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#2 - V1"},
+		},
+		{
+			Type:             "SomethingHappened",
+			AggregateID:      "AggregateID#1",
+			AggregateVersion: 2,
+			AggregateType:    "AggregateType",
+			Payload:          &SomethingHappened{Data: "AggregateID#1 - V2"},
+		},
+	})
+	s.NoError(err)
+
+	events, err := s.driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(int64(1), events[0].Position)
+	s.Equal(&SomethingHappened{Data: "AggregateID#1 - V1"}, events[0].Payload)
+	s.Equal(int64(3), events[1].Position)
+	s.Equal(int64(2), events[1].AggregateVersion)
+	s.Equal(&SomethingHappened{Data: "AggregateID#1 - V2"}, events[1].Payload)
+	s.WithinDuration(time.Now(), events[1].Created, time.Minute)
+
+	version, err := s.driver.LatestVersion(context.Background(), "AggregateID#1")
+	s.NoError(err)
+	s.Equal(int64(2), version)
+
+	events, err = s.driver.LoadAfter(context.Background(), "AggregateID#1", 1)
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(int64(3), events[0].Position)
+}
+
+func (s *SQLiteDriverSuite) TestSaveOptimisticLocking() {
+	err := s.driver.Save([]*es.Event{es.NewEvent("AggregateID#1", &SomethingHappened{})})
+	s.NoError(err)
+
+	err = s.driver.Save([]*es.Event{es.NewEvent("AggregateID#1", &SomethingHappened{})})
+	s.Regexp("UNIQUE constraint failed.*", err.Error())
+	s.True(errors.Is(err, es.ErrOptimisticLocking))
+}
+
+func (s *SQLiteDriverSuite) TestSaveInTransaction() {
+	err := s.driver.Save([]*es.Event{
+		es.NewEvent("AggregateID#1", &SomethingHappened{}),
+		es.NewEvent("AggregateID#1", &SomethingHappened{}),
+	})
+	s.Error(err)
+
+	var count int
+	err = s.db.QueryRow(`SELECT COUNT(*) FROM events`).Scan(&count)
+	s.NoError(err)
+	s.Equal(0, count)
+}
+
+func (s *SQLiteDriverSuite) TestReadEventsForward() {
+	err := s.driver.Save([]*es.Event{
+		es.NewEvent("AggregateID#1", &SomethingHappened{Data: "1"}),
+		es.NewEvent("AggregateID#2", &SomethingElseHappened{Data: "2"}),
+		es.NewEvent("AggregateID#3", &SomethingHappened{Data: "3"}),
+	})
+	s.NoError(err)
+
+	events, err := s.driver.ReadEventsOfTypes(0, 2, []string{"SomethingHappened", "SomethingElseHappened"})
+	s.NoError(err)
+	s.Equal(2, len(events))
+	s.Equal(int64(1), events[0].Position)
+	s.Equal(int64(2), events[1].Position)
+
+	events, err = s.driver.ReadEventsOfTypes(1, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(int64(3), events[0].Position)
+	s.Equal(&SomethingHappened{Data: "3"}, events[0].Payload)
+
+	events, err = s.driver.ReadEventsOfTypes(3, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events)
+}
+
+func (s *SQLiteDriverSuite) TestNeverReusesPositions() {
+	err := s.driver.Save([]*es.Event{es.NewEvent("AggregateID#1", &SomethingHappened{})})
+	s.NoError(err)
+	err = s.driver.RemoveStream(context.Background(), "AggregateID#1")
+	s.NoError(err)
+
+	err = s.driver.Save([]*es.Event{es.NewEvent("AggregateID#2", &SomethingHappened{})})
+	s.NoError(err)
+	events, err := s.driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(int64(2), events[0].Position)
+}
+
+func (s *SQLiteDriverSuite) TestTenantIsolation() {
+	driver := es.NewSQLiteDriver(s.db, es.WithSQLiteTenancy())
+	acme := es.WithTenant(context.Background(), "acme")
+	globex := es.WithTenant(context.Background(), "globex")
+
+	err := driver.SaveContext(acme, []*es.Event{es.NewEvent("AggregateID#1", &SomethingHappened{Data: "acme"})})
+	s.NoError(err)
+
+	events, err := driver.LoadContext(acme, "AggregateID#1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal("acme", events[0].TenantID)
+	events, err = driver.LoadContext(globex, "AggregateID#1")
+	s.NoError(err)
+	s.Empty(events)
+	events, err = driver.ReadEventsOfTypesContext(globex, 0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Empty(events)
+
+	_, err = driver.Load("AggregateID#1")
+	s.Equal(es.ErrTenantRequired, err)
+}
+
+func (s *SQLiteDriverSuite) TestPersistsInWALMode() {
+	err := s.driver.Save([]*es.Event{es.NewEvent("AggregateID#1", &SomethingHappened{Data: "1"})})
+	s.NoError(err)
+
+	var mode string
+	err = s.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode)
+	s.NoError(err)
+	s.Equal("wal", mode)
+
+	reopened := es.MustOpenSQLite(filepath.Join(s.dir, "events.db"))
+	defer es.ShouldClose(reopened)
+	events, err := (&es.SQLiteDriver{DB: reopened}).Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(&SomethingHappened{Data: "1"}, events[0].Payload)
+}
+
+func (s *SQLiteDriverSuite) TestDecodesWithRegistry() {
+	err := s.driver.Save([]*es.Event{es.NewEvent("AggregateID#1", &SomethingPrivateHappened{Data: "private"})})
+	s.NoError(err)
+
+	_, err = s.driver.Load("AggregateID#1")
+	s.Error(err)
+
+	driver := es.NewSQLiteDriver(s.db, es.WithSQLiteRegistry(privateRegistry()))
+	events, err := driver.Load("AggregateID#1")
+	s.NoError(err)
+	s.Equal(&SomethingPrivateHappened{Data: "private"}, events[0].Payload)
+}
+
+func (s *SQLiteDriverSuite) TestSkipsUnknownTypes() {
+	err := s.driver.Save([]*es.Event{
+		es.NewEvent("AggregateID#1", &SomethingPrivateHappened{Data: "private"}),
+		es.NewEvent("AggregateID#2", &SomethingHappened{Data: "known"}),
+	})
+	s.NoError(err)
+
+	registry := es.NewRegistry()
+	s.NoError(registry.Register(SomethingHappened{}))
+	registry.SetUnknownTypePolicy(es.SkipUnknownTypes)
+	driver := es.NewSQLiteDriver(s.db, es.WithSQLiteRegistry(registry))
+
+	events, err := driver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened", "SomethingPrivateHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events))
+	s.Equal(int64(2), events[0].Position)
+}
+
+func (s *SQLiteDriverSuite) TestReadsPastSkippedTypes() {
+	err := s.driver.Save([]*es.Event{
+		es.NewEvent("AggregateID#1", &SomethingPrivateHappened{Data: "private"}),
+		es.NewEvent("AggregateID#2", &SomethingPrivateHappened{Data: "private"}),
+		es.NewEvent("AggregateID#3", &SomethingHappened{Data: "known"}),
+	})
+	s.NoError(err)
+
+	registry := es.NewRegistry()
+	s.NoError(registry.Register(SomethingHappened{}))
+	registry.SetUnknownTypePolicy(es.SkipUnknownTypes)
+	driver := es.NewSQLiteDriver(s.db, es.WithSQLiteRegistry(registry))
+
+	events, err := driver.ReadEventsOfTypes(0, 2, []string{"SomethingHappened", "SomethingPrivateHappened"})
+	s.NoError(err)
+	s.Equal(1, len(events), "Skipped events don't fill the page")
+	s.Equal(int64(3), events[0].Position)
+}
+
+func TestSQLiteDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		dir, err := ioutil.TempDir("", "sqlite")
+		require.NoError(t, err)
+		db := es.MustOpenSQLite(filepath.Join(dir, "events.db"))
+		driver := &es.SQLiteDriver{DB: db}
+		require.NoError(t, driver.CreateTable())
+		return driver, func() {
+			es.ShouldClose(db)
+			_ = os.RemoveAll(dir)
+		}
+	})
+}
@@ -1,39 +1,147 @@
 package es
 
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StoreOption configures a Store
+type StoreOption func(*Store)
+
+// WithStoreTracer creates an OpenTelemetry span for every `Load` and `Save`
+func WithStoreTracer(tracer trace.Tracer) StoreOption {
+	return func(s *Store) {
+		s.tracer = tracer
+	}
+}
+
+// WithStoreClock stamps saved events with the given clock, whichever driver
+// saves them, overriding the time they were created at
+func WithStoreClock(clock Clock) StoreOption {
+	return func(s *Store) {
+		s.clock = clock
+	}
+}
+
+// WithStoreIDs gives saved events IDs from the given generator, replacing
+// those they were created with
+func WithStoreIDs(ids IDGenerator) StoreOption {
+	return func(s *Store) {
+		s.ids = ids
+	}
+}
+
+// WithStoreRegistry validates saved events and decodes loaded ones with the
+// given registry, whichever driver loads them
+func WithStoreRegistry(registry *Registry) StoreOption {
+	return func(s *Store) {
+		s.registry = registry
+	}
+}
+
 // Store implementation
 type Store struct {
-	driver Driver
+	driver   Driver
+	tracer   trace.Tracer
+	clock    Clock
+	ids      IDGenerator
+	registry *Registry
 }
 
 // NewStore creates a new store
-func NewStore(driver Driver) *Store {
-	return &Store{
+func NewStore(driver Driver, options ...StoreOption) *Store {
+	s := &Store{
 		driver: driver,
+		tracer: trace.NewNoopTracerProvider().Tracer(""),
+	}
+	for _, option := range options {
+		option(s)
 	}
+	return s
 }
 
 // Load loads aggregate by ID
 func (s *Store) Load(aggregateID string, aggregate Aggregate) error {
+	return s.LoadContext(context.Background(), aggregateID, aggregate)
+}
+
+// LoadContext loads aggregate by ID, propagating the context to the driver.
+// The store registry, if any, is carried by the context.
+func (s *Store) LoadContext(ctx context.Context, aggregateID string, aggregate Aggregate) error {
 	if aggregateID == "" {
 		return nil
 	}
+	if s.registry != nil {
+		ctx = WithRegistry(ctx, s.registry)
+	}
+
+	ctx, span := s.tracer.Start(ctx, "es.Store.Load", trace.WithAttributes(
+		attribute.String("es.aggregate_id", aggregateID),
+	))
+	defer span.End()
 
-	events, err := s.driver.Load(aggregateID)
+	events, err := loadContext(ctx, s.driver, aggregateID)
 	if err != nil {
+		recordError(span, err)
 		return err
 	}
 	for _, event := range events {
-		aggregate.Reduce(event.Type, event.Payload)
+		payload, err := event.DecodePayload()
+		if err != nil {
+			recordError(span, err)
+			return err
+		}
+		aggregate.Reduce(event.Type, payload)
 		aggregate.setVersion(event.AggregateVersion)
 	}
+	span.SetAttributes(attribute.Int("es.event_count", len(events)))
 	return nil
 }
 
 // Save saves aggregate events
 func (s *Store) Save(appliedEvents []*AppliedEvent) error {
+	return s.SaveContext(context.Background(), appliedEvents)
+}
+
+// SaveContext saves aggregate events, propagating the context to the driver.
+// Events are validated with the context registry, else the store one, else
+// `DefaultRegistry`, saving none of them when any is invalid. Events not
+// explicitly set with a tenant ID get the context one, and the store clock,
+// if any, is carried by the context. Events get IDs from the store
+// generator, if any.
+func (s *Store) SaveContext(ctx context.Context, appliedEvents []*AppliedEvent) error {
 	events := []*Event{}
 	for _, appliedEvent := range appliedEvents {
 		events = append(events, appliedEvent.Event)
 	}
-	return s.driver.Save(events)
+	err := stampTenant(ctx, events, false)
+	if err != nil {
+		return err
+	}
+	err = contextRegistry(ctx, s.registry).ValidateEvents(events)
+	if err != nil {
+		return err
+	}
+	if s.ids != nil {
+		for _, event := range events {
+			event.ID = s.ids.NewID()
+		}
+	}
+	if s.clock != nil {
+		ctx = WithClock(ctx, s.clock)
+	}
+
+	ctx, span := s.tracer.Start(ctx, "es.Store.Save", trace.WithAttributes(
+		eventsAttributes(events)...,
+	))
+	defer span.End()
+
+	err = saveContext(ctx, s.driver, events)
+	if err != nil {
+		recordError(span, err)
+		return err
+	}
+	return nil
 }
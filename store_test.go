@@ -1,10 +1,15 @@
 package es_test
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/indebted-modules/es"
 	"github.com/stretchr/testify/suite"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type StoreSuite struct {
@@ -66,3 +71,141 @@ func (s *StoreSuite) evtVersion(event *es.Event, version int64) *es.Event {
 	event.AggregateVersion = version
 	return event
 }
+
+func (s *StoreSuite) TestTracesLoadAndSaveAroundDriverSpans() {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("es_test")
+	store := es.NewStore(es.NewTracingDriver(es.NewInMemoryDriver(), tracer), es.WithStoreTracer(tracer))
+
+	sampleAggregate := &SampleAggregate{}
+	err := store.Save(sampleAggregate.DoSomething("1", []string{"event-1", "event-2"}))
+	s.NoError(err)
+	err = store.Load("1", &SampleAggregate{})
+	s.NoError(err)
+
+	spans := recorder.Ended()
+	s.Equal(4, len(spans))
+	s.Equal("es.Driver.Save", spans[0].Name())
+	s.Equal("es.Store.Save", spans[1].Name())
+	s.Equal(spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	s.Equal("es.Driver.Load", spans[2].Name())
+	s.Equal("es.Store.Load", spans[3].Name())
+	s.Equal(spans[3].SpanContext().SpanID(), spans[2].Parent().SpanID())
+}
+
+func (s *StoreSuite) TestIsolatesTenants() {
+	driver := es.NewInMemoryDriver(es.WithInMemoryTenancy())
+	store := es.NewStore(driver)
+	acme := es.WithTenant(context.Background(), "acme")
+
+	sampleAggregate := &SampleAggregate{}
+	err := store.SaveContext(acme, sampleAggregate.DoSomething("1", []string{"event-1"}))
+	s.NoError(err)
+	s.Equal("acme", driver.Stream()[0].TenantID)
+
+	sampleAggregate = &SampleAggregate{}
+	err = store.LoadContext(acme, "1", sampleAggregate)
+	s.NoError(err)
+	s.Equal([]string{"event-1"}, sampleAggregate.ReducedData)
+
+	sampleAggregate = &SampleAggregate{}
+	err = store.LoadContext(es.WithTenant(context.Background(), "globex"), "1", sampleAggregate)
+	s.NoError(err)
+	s.Empty(sampleAggregate.ReducedData)
+
+	err = store.Load("1", &SampleAggregate{})
+	s.Equal(es.ErrTenantRequired, err)
+	err = store.Save(sampleAggregate.DoSomething("2", []string{"event-2"}))
+	s.Equal(es.ErrTenantRequired, err)
+}
+
+func (s *StoreSuite) TestRejectsEventsOfAnotherTenant() {
+	store := es.NewStore(es.NewInMemoryDriver())
+
+	appliedEvents := (&SampleAggregate{}).DoSomething("1", []string{"event-1"})
+	appliedEvents[0].Event.TenantID = "globex"
+	err := store.SaveContext(es.WithTenant(context.Background(), "acme"), appliedEvents)
+	s.Equal(es.ErrTenantMismatch, err)
+}
+
+func (s *StoreSuite) TestStampsEventsWithStoreClock() {
+	created := time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC)
+	driver := es.NewInMemoryDriver()
+	store := es.NewStore(driver, es.WithStoreClock(es.FixedClock(created)))
+
+	err := store.Save((&SampleAggregate{}).DoSomething("1", []string{"event-1", "event-2"}))
+	s.NoError(err)
+
+	stream := driver.Stream()
+	s.Equal(2, len(stream))
+	s.Equal(created, stream[0].Created)
+	s.Equal(created, stream[1].Created)
+}
+
+func (s *StoreSuite) TestKeepsCreationTimesWithoutStoreClock() {
+	created := time.Date(1985, time.October, 26, 1, 22, 0, 0, time.UTC)
+	driver := es.NewInMemoryDriver()
+	aggregate := &SampleAggregate{}
+	err := es.NewStore(driver).Save(aggregate.Apply(aggregate, []*es.Event{
+		es.NewEvent("1", &SomethingHappened{}, es.WithEventClock(es.FixedClock(created))),
+	}))
+	s.NoError(err)
+
+	stream := driver.Stream()
+	s.Equal(1, len(stream))
+	s.Equal(created, stream[0].Created)
+}
+
+func (s *StoreSuite) TestGivesEventsStoreIDs() {
+	driver := es.NewInMemoryDriver()
+	next := 0
+	store := es.NewStore(driver, es.WithStoreIDs(es.IDGeneratorFunc(func() string {
+		next++
+		return fmt.Sprintf("store-%d", next)
+	})))
+
+	appliedEvents := (&SampleAggregate{}).DoSomething("1", []string{"event-1", "event-2"})
+	err := store.Save(appliedEvents)
+	s.NoError(err)
+
+	stream := driver.Stream()
+	s.Equal(2, len(stream))
+	s.Equal("store-1", stream[0].ID)
+	s.Equal("store-2", stream[1].ID)
+	s.Equal("store-1", appliedEvents[0].Event.ID)
+}
+
+func (s *StoreSuite) TestLoadsWithStoreRegistry() {
+	registry := privateRegistry()
+	driver := es.NewInMemoryDriver()
+	aggregate := &SampleAggregate{}
+	err := es.NewStore(driver, es.WithStoreRegistry(registry)).Save(aggregate.Apply(aggregate, []*es.Event{
+		es.NewEvent("1", &SomethingPrivateHappened{Data: "private"}, es.WithEventRegistry(registry)),
+	}))
+	s.NoError(err)
+
+	err = es.NewStore(driver).Load("1", &SampleAggregate{})
+	s.EqualError(err, "No type registered for 'SomethingPrivateHappened'")
+
+	loaded := &SampleAggregate{}
+	err = es.NewStore(driver, es.WithStoreRegistry(registry)).Load("1", loaded)
+	s.NoError(err)
+	applied := loaded.Apply(loaded, []*es.Event{es.NewEvent("1", &SomethingPrivateHappened{})})
+	s.Equal(int64(2), applied[0].Event.AggregateVersion)
+}
+
+func (s *StoreSuite) TestLoadsLazilyDecodedEvents() {
+	registry := es.NewRegistry()
+	s.NoError(registry.Register(SomethingHappened{}))
+	registry.SetLazyDecoding(true)
+	driver := es.NewInMemoryDriver(es.WithInMemoryRegistry(registry))
+	store := es.NewStore(driver)
+
+	err := store.Save((&SampleAggregate{}).DoSomething("1", []string{"event-1", "event-2"}))
+	s.NoError(err)
+
+	loaded := &SampleAggregate{}
+	err = store.Load("1", loaded)
+	s.NoError(err)
+	s.Equal([]string{"event-1", "event-2"}, loaded.ReducedData)
+}
@@ -99,6 +99,29 @@ func (SomethingElseHappened) AggregateType() string {
 	return "AnotherSampleAggregate"
 }
 
+// SomethingPrivateHappened event sample left out of the default registry
+type SomethingPrivateHappened struct {
+	Data string
+}
+
+func (SomethingPrivateHappened) PayloadType() string {
+	return "SomethingPrivateHappened"
+}
+
+func (SomethingPrivateHappened) AggregateType() string {
+	return "SampleAggregate"
+}
+
+// privateRegistry creates a registry knowing SomethingPrivateHappened only
+func privateRegistry() *es.Registry {
+	registry := es.NewRegistry()
+	err := registry.Register(SomethingPrivateHappened{})
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
 func init() {
 	es.Register(SomethingHappened{})
 	es.Register(SomethingElseHappened{})
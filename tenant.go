@@ -0,0 +1,59 @@
+package es
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTenantRequired is returned by multi-tenant drivers when neither the
+// context nor the events carry a tenant ID
+var ErrTenantRequired = errors.New("tenant required")
+
+// ErrTenantMismatch is returned when saving events whose tenant ID differs
+// from the one carried by the context
+var ErrTenantMismatch = errors.New("event tenant does not match context tenant")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of the context carrying the given tenant ID.
+// Drivers scope loads and reads to it, and stamp it on saved events. Without
+// one, they only see events saved without a tenant.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID carried by the context, or an empty
+// string when there is none
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey{}).(string)
+	return tenantID
+}
+
+// contextTenant returns the tenant ID carried by the context, failing when
+// it's required and missing
+func contextTenant(ctx context.Context, required bool) (string, error) {
+	tenantID := TenantFromContext(ctx)
+	if required && tenantID == "" {
+		return "", ErrTenantRequired
+	}
+	return tenantID, nil
+}
+
+// stampTenant sets the context tenant ID on events not explicitly set with
+// one, failing on events explicitly set with another one, or on events
+// left without one when it's required
+func stampTenant(ctx context.Context, events []*Event, required bool) error {
+	tenantID := TenantFromContext(ctx)
+	for _, event := range events {
+		if event.TenantID == "" {
+			event.TenantID = tenantID
+		}
+		if tenantID != "" && event.TenantID != tenantID {
+			return ErrTenantMismatch
+		}
+		if required && event.TenantID == "" {
+			return ErrTenantRequired
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package es
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracingDriver creates a new TracingDriver
+func NewTracingDriver(driver Driver, tracer trace.Tracer) *TracingDriver {
+	return &TracingDriver{
+		Driver: driver,
+		tracer: tracer,
+	}
+}
+
+// TracingDriver implementation creating an OpenTelemetry span for every call
+// to the internal driver. Spans are children of the span found in the
+// context given to the `ContextDriver` methods, which is propagated to the
+// internal driver.
+type TracingDriver struct {
+	Driver Driver
+	tracer trace.Tracer
+}
+
+// Load delegates to internal driver
+func (d *TracingDriver) Load(aggregateID string) ([]*Event, error) {
+	return d.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (d *TracingDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	ctx, span := d.tracer.Start(ctx, "es.Driver.Load", trace.WithAttributes(
+		attribute.String("es.aggregate_id", aggregateID),
+	))
+	defer span.End()
+
+	events, err := loadContext(ctx, d.Driver, aggregateID)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("es.event_count", len(events)))
+	return events, nil
+}
+
+// Save delegates to internal driver
+func (d *TracingDriver) Save(events []*Event) error {
+	return d.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (d *TracingDriver) SaveContext(ctx context.Context, events []*Event) error {
+	ctx, span := d.tracer.Start(ctx, "es.Driver.Save", trace.WithAttributes(
+		eventsAttributes(events)...,
+	))
+	defer span.End()
+
+	err := saveContext(ctx, d.Driver, events)
+	if err != nil {
+		recordError(span, err)
+		return err
+	}
+
+	return nil
+}
+
+// ReadEventsOfTypes delegates to internal driver
+func (d *TracingDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
+	return d.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (d *TracingDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	ctx, span := d.tracer.Start(ctx, "es.Driver.ReadEventsOfTypes", trace.WithAttributes(
+		attribute.Int64("es.position", position),
+		attribute.Int64("es.limit", int64(count)),
+		attribute.StringSlice("es.event_types", types),
+	))
+	defer span.End()
+
+	events, err := readEventsOfTypesContext(ctx, d.Driver, position, count, types)
+	if err != nil {
+		recordError(span, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("es.event_count", len(events)))
+	return events, nil
+}
+
+// eventsAttributes describes the aggregates and types of the given events
+func eventsAttributes(events []*Event) []attribute.KeyValue {
+	aggregateIDs := []string{}
+	types := []string{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		if !seen["id:"+event.AggregateID] {
+			seen["id:"+event.AggregateID] = true
+			aggregateIDs = append(aggregateIDs, event.AggregateID)
+		}
+		if !seen["type:"+event.Type] {
+			seen["type:"+event.Type] = true
+			types = append(types, event.Type)
+		}
+	}
+
+	return []attribute.KeyValue{
+		attribute.StringSlice("es.aggregate_ids", aggregateIDs),
+		attribute.StringSlice("es.event_types", types),
+		attribute.Int("es.event_count", len(events)),
+	}
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
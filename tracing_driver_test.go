@@ -0,0 +1,131 @@
+package es_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TracingDriverSuite struct {
+	suite.Suite
+	recorder *tracetest.SpanRecorder
+	tracer   trace.Tracer
+}
+
+func TestTracingDriverSuite(t *testing.T) {
+	suite.Run(t, new(TracingDriverSuite))
+}
+
+func (s *TracingDriverSuite) SetupTest() {
+	s.recorder = tracetest.NewSpanRecorder()
+	s.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.recorder)).Tracer("es_test")
+}
+
+func (s *TracingDriverSuite) TestTracesLoad() {
+	driver := es.NewInMemoryDriver()
+	err := driver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	tracingDriver := es.NewTracingDriver(driver, s.tracer)
+	events, err := tracingDriver.Load("123")
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+
+	spans := s.recorder.Ended()
+	s.Equal(1, len(spans))
+	s.Equal("es.Driver.Load", spans[0].Name())
+	s.Equal(map[attribute.Key]attribute.Value{
+		"es.aggregate_id": attribute.StringValue("123"),
+		"es.event_count":  attribute.IntValue(1),
+	}, s.attributes(spans[0]))
+}
+
+func (s *TracingDriverSuite) TestTracesSave() {
+	driver := es.NewInMemoryDriver()
+	tracingDriver := es.NewTracingDriver(driver, s.tracer)
+
+	err := tracingDriver.Save([]*es.Event{
+		es.NewEvent("123", &SomethingHappened{}),
+		es.NewEvent("456", &SomethingElseHappened{}),
+		es.NewEvent("789", &SomethingHappened{}),
+	})
+	s.NoError(err)
+	s.Equal(3, len(driver.Stream()))
+
+	spans := s.recorder.Ended()
+	s.Equal(1, len(spans))
+	s.Equal("es.Driver.Save", spans[0].Name())
+	s.Equal(map[attribute.Key]attribute.Value{
+		"es.aggregate_ids": attribute.StringSliceValue([]string{"123", "456", "789"}),
+		"es.event_types":   attribute.StringSliceValue([]string{"SomethingHappened", "SomethingElseHappened"}),
+		"es.event_count":   attribute.IntValue(3),
+	}, s.attributes(spans[0]))
+}
+
+func (s *TracingDriverSuite) TestTracesReadEventsOfTypes() {
+	driver := es.NewInMemoryDriver()
+	err := driver.Save([]*es.Event{es.NewEvent("123", &SomethingHappened{})})
+	s.NoError(err)
+
+	tracingDriver := es.NewTracingDriver(driver, s.tracer)
+	events, err := tracingDriver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+	s.Equal(&SomethingHappened{}, events[0].Payload)
+
+	spans := s.recorder.Ended()
+	s.Equal(1, len(spans))
+	s.Equal("es.Driver.ReadEventsOfTypes", spans[0].Name())
+	s.Equal(map[attribute.Key]attribute.Value{
+		"es.position":    attribute.Int64Value(0),
+		"es.limit":       attribute.Int64Value(10),
+		"es.event_types": attribute.StringSliceValue([]string{"SomethingHappened"}),
+		"es.event_count": attribute.IntValue(1),
+	}, s.attributes(spans[0]))
+}
+
+func (s *TracingDriverSuite) TestRecordsErrors() {
+	tracingDriver := es.NewTracingDriver(&BrokenDriver{ErrorMessage: "borked!"}, s.tracer)
+	_, err := tracingDriver.Load("123")
+	s.Error(err)
+
+	spans := s.recorder.Ended()
+	s.Equal(1, len(spans))
+	s.Equal(codes.Error, spans[0].Status().Code)
+	s.Equal("borked!", spans[0].Status().Description)
+	s.Equal(1, len(spans[0].Events()))
+}
+
+func (s *TracingDriverSuite) TestNestsSpansUnderContextSpan() {
+	ctx, parent := s.tracer.Start(context.Background(), "command")
+	tracingDriver := es.NewTracingDriver(es.NewTracingDriver(es.NewInMemoryDriver(), s.tracer), s.tracer)
+	_, err := tracingDriver.LoadContext(ctx, "123")
+	s.NoError(err)
+	parent.End()
+
+	spans := s.recorder.Ended()
+	s.Equal(3, len(spans))
+	s.Equal(spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID(), "Decorated driver span is a child of the decorator span")
+	s.Equal(parent.SpanContext().SpanID(), spans[1].Parent().SpanID(), "Decorator span is a child of the context span")
+}
+
+func (s *TracingDriverSuite) attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	return attributes
+}
+
+func TestTracingDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		return es.NewTracingDriver(es.NewInMemoryDriver(), trace.NewNoopTracerProvider().Tracer("estest")), nil
+	})
+}
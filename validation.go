@@ -0,0 +1,132 @@
+package es
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Validator is optionally implemented by payloads checking their own
+// invariants before being saved
+type Validator interface {
+	Validate() error
+}
+
+// EventError holds everything wrong with an event
+type EventError struct {
+	Event  *Event
+	Errors []error
+}
+
+// Error implements `error`
+func (e *EventError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid event '%s' of aggregate '%s' (version %d): %s", e.Event.Type, e.Event.AggregateID, e.Event.AggregateVersion, strings.Join(messages, "; "))
+}
+
+// Unwrap returns the errors of the event
+func (e *EventError) Unwrap() []error {
+	return e.Errors
+}
+
+// ValidationError holds the errors of every invalid event of a save
+type ValidationError struct {
+	Events []*EventError
+}
+
+// Error implements `error`
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Events))
+	for i, err := range e.Events {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Unwrap returns the errors of the invalid events
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Events))
+	for i, err := range e.Events {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ValidateEvents checks that the payload of every given event is a pointer
+// to the type registered for the event type, matching its schema in strict
+// mode, that its aggregate type matches the event and the other given
+// events of the same tenant and aggregate, and that it's valid when
+// implementing `Validator`. Events loaded lazily are left unchecked. It
+// returns a `*ValidationError` aggregating the errors per event, if any.
+func (r *Registry) ValidateEvents(events []*Event) error {
+	var invalid []*EventError
+	streams := map[[2]string]string{}
+	for _, event := range events {
+		errs := r.validateEvent(event)
+
+		stream := [2]string{event.TenantID, event.AggregateID}
+		aggregateType, ok := streams[stream]
+		if !ok {
+			streams[stream] = event.AggregateType
+		} else if aggregateType != event.AggregateType {
+			errs = append(errs, fmt.Errorf("aggregate type '%s' does not match '%s' of the stream", event.AggregateType, aggregateType))
+		}
+
+		if len(errs) > 0 {
+			invalid = append(invalid, &EventError{Event: event, Errors: errs})
+		}
+	}
+
+	if len(invalid) > 0 {
+		return &ValidationError{Events: invalid}
+	}
+	return nil
+}
+
+// validateEvent returns everything wrong with the payload of the given event
+func (r *Registry) validateEvent(event *Event) []error {
+	if event.raw != nil {
+		return nil
+	}
+	if event.Payload == nil {
+		return []error{fmt.Errorf("missing payload")}
+	}
+
+	var errs []error
+	if reflect.TypeOf(event.Payload).Kind() != reflect.Ptr {
+		errs = append(errs, fmt.Errorf("payload %T is not a pointer", event.Payload))
+	}
+	payload, ok := event.Payload.(EventPayload)
+	if !ok {
+		return append(errs, fmt.Errorf("payload %T does not implement EventPayload", event.Payload))
+	}
+
+	if payload.PayloadType() != event.Type {
+		errs = append(errs, fmt.Errorf("payload type '%s' does not match event type '%s'", payload.PayloadType(), event.Type))
+	}
+	// Raw payloads are loaded from unknown types on purpose
+	if _, raw := payload.(*RawPayload); !raw {
+		resolved, err := r.ResolveType(event.Type)
+		if err != nil {
+			errs = append(errs, err)
+		} else if reflect.TypeOf(resolved) != reflect.TypeOf(payload) {
+			errs = append(errs, fmt.Errorf("payload %T is not the type registered for '%s'", payload, event.Type))
+		} else {
+			errs = append(errs, r.validateSchema(event.Type, payload)...)
+		}
+	}
+	if payload.AggregateType() != event.AggregateType {
+		errs = append(errs, fmt.Errorf("payload aggregate type '%s' does not match event aggregate type '%s'", payload.AggregateType(), event.AggregateType))
+	}
+
+	if validator, ok := payload.(Validator); ok {
+		err := validator.Validate()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,121 @@
+package es_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/indebted-modules/es"
+	"github.com/stretchr/testify/suite"
+)
+
+type ValidationSuite struct {
+	suite.Suite
+	registry *es.Registry
+}
+
+func TestValidationSuite(t *testing.T) {
+	suite.Run(t, new(ValidationSuite))
+}
+
+var errNegativeAmount = errors.New("negative amount")
+
+// Deposited event sample validating itself
+type Deposited struct {
+	Amount int
+}
+
+func (Deposited) PayloadType() string {
+	return "Deposited"
+}
+
+func (Deposited) AggregateType() string {
+	return "Account"
+}
+
+func (d *Deposited) Validate() error {
+	if d.Amount < 0 {
+		return errNegativeAmount
+	}
+	return nil
+}
+
+func (s *ValidationSuite) SetupTest() {
+	s.registry = es.NewRegistry()
+	s.Require().NoError(s.registry.Register(Deposited{}))
+	s.Require().NoError(s.registry.Register(SomethingHappened{}))
+}
+
+func (s *ValidationSuite) TestNewEventAcceptsValidPayloads() {
+	event := es.NewEvent("1", &Deposited{Amount: 10}, es.WithEventRegistry(s.registry))
+	s.NoError(event.Err())
+}
+
+func (s *ValidationSuite) TestNewEventRejectsInvalidPayloads() {
+	event := es.NewEvent("1", SomethingHappened{}, es.WithEventRegistry(s.registry))
+	s.EqualError(event.Err(), "invalid event 'SomethingHappened' of aggregate '1' (version 0): payload es_test.SomethingHappened is not a pointer; payload es_test.SomethingHappened is not the type registered for 'SomethingHappened'")
+
+	event = es.NewEvent("1", &SomethingElseHappened{}, es.WithEventRegistry(s.registry))
+	s.EqualError(event.Err(), "invalid event 'SomethingElseHappened' of aggregate '1' (version 0): No type registered for 'SomethingElseHappened'")
+
+	event = es.NewEvent("1", &Deposited{Amount: -1}, es.WithEventRegistry(s.registry))
+	s.True(errors.Is(event.Err(), errNegativeAmount))
+}
+
+func (s *ValidationSuite) TestValidateEventsAggregatesErrorsPerEvent() {
+	mistyped := es.NewEvent("1", &Deposited{Amount: 1})
+	mistyped.AggregateType = "Wallet"
+	events := []*es.Event{
+		es.NewEvent("1", &Deposited{Amount: 1}),
+		es.NewEvent("1", &Deposited{Amount: -1}),
+		mistyped,
+		es.NewEvent("2", &SomethingHappened{}),
+	}
+
+	err := s.registry.ValidateEvents(events)
+	var validationErr *es.ValidationError
+	s.Require().True(errors.As(err, &validationErr))
+	s.Equal(2, len(validationErr.Events))
+
+	s.Equal(events[1], validationErr.Events[0].Event)
+	s.Equal([]error{errNegativeAmount}, validationErr.Events[0].Errors)
+
+	s.Equal(mistyped, validationErr.Events[1].Event)
+	s.Equal(2, len(validationErr.Events[1].Errors))
+	s.EqualError(validationErr.Events[1].Errors[0], "payload aggregate type 'Account' does not match event aggregate type 'Wallet'")
+	s.EqualError(validationErr.Events[1].Errors[1], "aggregate type 'Wallet' does not match 'Account' of the stream")
+
+	s.True(errors.Is(err, errNegativeAmount))
+}
+
+func (s *ValidationSuite) TestValidateEventsAcceptsRawPayloads() {
+	event := &es.Event{
+		Type:          "Unknown",
+		AggregateID:   "1",
+		AggregateType: "Account",
+		Payload:       &es.RawPayload{TypeName: "Unknown", AggregateTypeName: "Account", JSON: []byte(`{}`)},
+	}
+	s.NoError(s.registry.ValidateEvents([]*es.Event{event}))
+}
+
+func (s *ValidationSuite) TestStoreRejectsInvalidEvents() {
+	driver := es.NewInMemoryDriver()
+	store := es.NewStore(driver, es.WithStoreRegistry(s.registry))
+	aggregate := &SampleAggregate{}
+
+	err := store.Save(aggregate.Apply(aggregate, []*es.Event{
+		es.NewEvent("1", &SomethingHappened{Data: "valid"}),
+		es.NewEvent("1", &SomethingElseHappened{Data: "invalid"}),
+	}))
+	var validationErr *es.ValidationError
+	s.Require().True(errors.As(err, &validationErr))
+	s.Equal(1, len(validationErr.Events))
+	s.Empty(driver.Stream(), "Nothing saved")
+}
+
+func (s *ValidationSuite) TestValidateEventsComparesStreamsPerTenant() {
+	acme := es.NewEvent("1", &Deposited{Amount: 1})
+	acme.TenantID = "acme"
+	globex := es.NewEvent("1", &SomethingHappened{})
+	globex.TenantID = "globex"
+	s.NoError(s.registry.ValidateEvents([]*es.Event{acme, globex}))
+}
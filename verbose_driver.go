@@ -1,45 +1,329 @@
 package es
 
-import "github.com/rs/zerolog/log"
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// redactedValue replaces the value of payload fields tagged with `es:"redact"`
+const redactedValue = "[REDACTED]"
+
+// VerboseOption configures a VerboseDriver
+type VerboseOption func(*VerboseDriver)
+
+// WithVerboseLogger replaces the global logger used by default
+func WithVerboseLogger(logger zerolog.Logger) VerboseOption {
+	return func(d *VerboseDriver) {
+		d.logger = logger
+	}
+}
+
+// WithVerboseLevels sets the levels produced events and reads (`Load` and
+// `ReadEventsOfTypes`) are logged with. Defaults to info and debug.
+func WithVerboseLevels(save zerolog.Level, read zerolog.Level) VerboseOption {
+	return func(d *VerboseDriver) {
+		d.saveLevel = save
+		d.readLevel = read
+	}
+}
+
+// WithVerbosePayloads includes event payloads in produced event logs. Payload
+// fields tagged with `es:"redact"` are logged as "[REDACTED]".
+func WithVerbosePayloads() VerboseOption {
+	return func(d *VerboseDriver) {
+		d.payloads = true
+	}
+}
+
+// WithVerboseSampler samples the logs of produced events and reads, keeping
+// high-volume streams from flooding the log pipeline. Failures are always
+// logged.
+func WithVerboseSampler(sampler zerolog.Sampler) VerboseOption {
+	return func(d *VerboseDriver) {
+		d.sampler = sampler
+	}
+}
 
 // NewVerboseDriver creates a new VerboseDriver
-func NewVerboseDriver(driver Driver) *VerboseDriver {
-	return &VerboseDriver{Driver: driver}
+func NewVerboseDriver(driver Driver, options ...VerboseOption) *VerboseDriver {
+	d := &VerboseDriver{
+		Driver:    driver,
+		logger:    log.Logger,
+		saveLevel: zerolog.InfoLevel,
+		readLevel: zerolog.DebugLevel,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	d.sampled = d.logger
+	if d.sampler != nil {
+		d.sampled = d.logger.Sample(d.sampler)
+	}
+	return d
 }
 
 // VerboseDriver implementation for deployed environments
 type VerboseDriver struct {
-	Driver Driver
+	Driver    Driver
+	logger    zerolog.Logger
+	sampled   zerolog.Logger
+	saveLevel zerolog.Level
+	readLevel zerolog.Level
+	payloads  bool
+	sampler   zerolog.Sampler
 }
 
-// Load delegates to internal driver
+// Load delegates to internal driver and logs how long it took and how many
+// events were loaded
 func (s *VerboseDriver) Load(aggregateID string) ([]*Event, error) {
-	return s.Driver.Load(aggregateID)
+	return s.LoadContext(context.Background(), aggregateID)
+}
+
+// LoadContext implements `ContextDriver`
+func (s *VerboseDriver) LoadContext(ctx context.Context, aggregateID string) ([]*Event, error) {
+	start := time.Now()
+	events, err := loadContext(ctx, s.Driver, aggregateID)
+	if err != nil {
+		s.logger.
+			Error().
+			Err(err).
+			Str("AggregateID", aggregateID).
+			Dur("Duration", time.Since(start)).
+			Msg("Failed loading events")
+
+		return nil, err
+	}
+
+	s.sampled.
+		WithLevel(s.readLevel).
+		Str("AggregateID", aggregateID).
+		Int("Count", len(events)).
+		Dur("Duration", time.Since(start)).
+		Msg("Loaded events")
+
+	return events, nil
 }
 
 // Save delegates to internal driver and log all produced events
 func (s *VerboseDriver) Save(events []*Event) error {
-	err := s.Driver.Save(events)
+	return s.SaveContext(context.Background(), events)
+}
+
+// SaveContext implements `ContextDriver`
+func (s *VerboseDriver) SaveContext(ctx context.Context, events []*Event) error {
+	start := time.Now()
+	err := saveContext(ctx, s.Driver, events)
 	if err != nil {
+		s.logger.
+			Error().
+			Err(err).
+			Int("Count", len(events)).
+			Dur("Duration", time.Since(start)).
+			Msg("Failed saving events")
+
 		return err
 	}
 
 	for _, event := range events {
-		log.
-			Info().
+		entry := s.sampled.
+			WithLevel(s.saveLevel).
 			Str("EventID", event.ID).
 			Str("EventType", event.Type).
 			Str("AggregateID", event.AggregateID).
 			Str("AggregateType", event.AggregateType).
 			Int64("AggregateVersion", event.AggregateVersion).
-			Time("Created", event.Created).
-			Msg("Produced event")
+			Time("Created", event.Created)
+		if s.payloads {
+			entry = entry.Interface("Payload", redact(event.Payload))
+		}
+		entry.Msg("Produced event")
 	}
 
 	return nil
 }
 
-// ReadEventsOfTypes .
+// ReadEventsOfTypes delegates to internal driver and logs how long it took
+// and how many events were read
 func (s *VerboseDriver) ReadEventsOfTypes(position int64, count uint, types []string) ([]*Event, error) {
-	return s.Driver.ReadEventsOfTypes(position, count, types)
+	return s.ReadEventsOfTypesContext(context.Background(), position, count, types)
+}
+
+// ReadEventsOfTypesContext implements `ContextDriver`
+func (s *VerboseDriver) ReadEventsOfTypesContext(ctx context.Context, position int64, count uint, types []string) ([]*Event, error) {
+	start := time.Now()
+	events, err := readEventsOfTypesContext(ctx, s.Driver, position, count, types)
+	if err != nil {
+		s.logger.
+			Error().
+			Err(err).
+			Int64("Position", position).
+			Uint("Limit", count).
+			Strs("Types", types).
+			Dur("Duration", time.Since(start)).
+			Msg("Failed reading events")
+
+		return nil, err
+	}
+
+	s.sampled.
+		WithLevel(s.readLevel).
+		Int64("Position", position).
+		Uint("Limit", count).
+		Strs("Types", types).
+		Int("Count", len(events)).
+		Dur("Duration", time.Since(start)).
+		Msg("Read events")
+
+	return events, nil
+}
+
+// redact copies the given payload into a loggable value, replacing fields
+// tagged with `es:"redact"` along the way. Values encoding themselves are
+// replaced entirely when they hold such fields, as they can't be redacted.
+func redact(payload interface{}) interface{} {
+	return redactValue(reflect.ValueOf(payload))
+}
+
+func redactValue(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if marshalsItself(v) {
+			if hasRedactedFields(v.Type(), map[reflect.Type]bool{}) {
+				return redactedValue
+			}
+			return v.Interface()
+		}
+		fields := map[string]interface{}{}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if tag, ok := field.Tag.Lookup("json"); ok {
+				tagName := strings.Split(tag, ",")[0]
+				if tagName == "-" {
+					continue
+				}
+				if tagName != "" {
+					name = tagName
+				}
+			}
+			if field.Tag.Get("es") == "redact" {
+				fields[name] = redactedValue
+				continue
+			}
+			fields[name] = redactValue(v.Field(i))
+		}
+		return fields
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if !mayHoldRedactedFields(v.Type().Elem()) {
+			return v.Interface()
+		}
+		items := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			items[i] = redactValue(v.Index(i))
+		}
+		return items
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if !mayHoldRedactedFields(v.Type().Elem()) {
+			return v.Interface()
+		}
+		items := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			items[mapKey(iter.Key())] = redactValue(iter.Value())
+		}
+		return items
+	case reflect.Invalid:
+		return nil
+	default:
+		return v.Interface()
+	}
+}
+
+// mayHoldRedactedFields tells whether values of the given type may hold
+// fields tagged with `es:"redact"`, interfaces being only known at runtime
+func mayHoldRedactedFields(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Interface || hasRedactedFields(t, map[reflect.Type]bool{})
+}
+
+// hasRedactedFields tells whether values of the given type hold fields tagged
+// with `es:"redact"`, at any depth
+func hasRedactedFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Tag.Get("es") == "redact" || hasRedactedFields(field.Type, seen) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return hasRedactedFields(t.Elem(), seen)
+	}
+	return false
+}
+
+// mapKey formats the given map key the way `encoding/json` does
+func mapKey(key reflect.Value) string {
+	if key.Kind() == reflect.String {
+		return key.String()
+	}
+	if marshaler, ok := key.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		if err == nil {
+			return string(text)
+		}
+	}
+	return fmt.Sprint(key.Interface())
+}
+
+func marshalsItself(v reflect.Value) bool {
+	if _, ok := v.Interface().(json.Marshaler); ok {
+		return true
+	}
+	if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return true
+	}
+	if v.CanAddr() {
+		return marshalsItself(v.Addr())
+	}
+	return false
 }
@@ -1,9 +1,13 @@
 package es_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/indebted-modules/es"
+	"github.com/indebted-modules/es/estest"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -45,3 +49,238 @@ func (s *VerboseDriverSuite) TestDelegateReadEventsOfTypesToInternalDriver() {
 	s.NoError(err)
 	s.Equal(&SomethingHappened{}, events[0].Payload)
 }
+
+func (s *VerboseDriverSuite) TestLogsProducedEventsWithInjectedLogger() {
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(
+		es.NewInMemoryDriver(),
+		es.WithVerboseLogger(zerolog.New(&buffer)),
+		es.WithVerboseLevels(zerolog.WarnLevel, zerolog.DebugLevel),
+	)
+
+	event := es.NewEvent("123", &SomethingHappened{Data: "secret"})
+	err := verboseDriver.Save([]*es.Event{event})
+	s.NoError(err)
+
+	logs := s.readLogs(&buffer)
+	s.Equal(1, len(logs))
+	s.Equal("warn", logs[0]["level"])
+	s.Equal("Produced event", logs[0]["message"])
+	s.Equal(event.ID, logs[0]["EventID"])
+	s.Equal("SomethingHappened", logs[0]["EventType"])
+	s.Equal("123", logs[0]["AggregateID"])
+	s.Equal("SampleAggregate", logs[0]["AggregateType"])
+	s.NotContains(logs[0], "Payload", "Payloads are not logged by default")
+}
+
+func (s *VerboseDriverSuite) TestLogsPayloadsWithRedactedFields() {
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(
+		es.NewInMemoryDriver(),
+		es.WithVerboseLogger(zerolog.New(&buffer)),
+		es.WithVerbosePayloads(),
+	)
+
+	err := verboseDriver.Save([]*es.Event{es.NewEvent("123", &DebtorContacted{
+		Name:    "John Doe",
+		Phone:   "0400 000 000",
+		Channel: "SMS",
+		Attempt: 2,
+	})})
+	s.NoError(err)
+
+	logs := s.readLogs(&buffer)
+	s.Equal(1, len(logs))
+	s.Equal(map[string]interface{}{
+		"Name":    "[REDACTED]",
+		"phone":   "[REDACTED]",
+		"Channel": "SMS",
+		"Attempt": float64(2),
+	}, logs[0]["Payload"])
+}
+
+func (s *VerboseDriverSuite) TestRedactsFieldsInsideMapsAndSlices() {
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(
+		es.NewInMemoryDriver(),
+		es.WithVerboseLogger(zerolog.New(&buffer)),
+		es.WithVerbosePayloads(),
+	)
+
+	err := verboseDriver.Save([]*es.Event{es.NewEvent("123", &DebtorsContacted{
+		ByChannel: map[string]DebtorContacted{"SMS": {Name: "John Doe", Channel: "SMS"}},
+		Any:       map[string]interface{}{"debtor": &DebtorContacted{Phone: "0400 000 000"}},
+		List:      []*DebtorContacted{{Name: "Jane Doe"}},
+	})})
+	s.NoError(err)
+
+	logs := s.readLogs(&buffer)
+	s.Equal(1, len(logs))
+	payload := logs[0]["Payload"].(map[string]interface{})
+	s.Equal("[REDACTED]", payload["ByChannel"].(map[string]interface{})["SMS"].(map[string]interface{})["Name"])
+	s.Equal("SMS", payload["ByChannel"].(map[string]interface{})["SMS"].(map[string]interface{})["Channel"])
+	s.Equal("[REDACTED]", payload["Any"].(map[string]interface{})["debtor"].(map[string]interface{})["phone"])
+	s.Equal("[REDACTED]", payload["List"].([]interface{})[0].(map[string]interface{})["Name"])
+}
+
+func (s *VerboseDriverSuite) TestRedactsSelfMarshalingPayloadsWithRedactedFields() {
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(
+		es.NewInMemoryDriver(),
+		es.WithVerboseLogger(zerolog.New(&buffer)),
+		es.WithVerbosePayloads(),
+	)
+
+	err := verboseDriver.Save([]*es.Event{es.NewEvent("123", &DebtorMarshaled{Name: "John Doe"})})
+	s.NoError(err)
+
+	logs := s.readLogs(&buffer)
+	s.Equal(1, len(logs))
+	s.Equal("[REDACTED]", logs[0]["Payload"])
+}
+
+func (s *VerboseDriverSuite) TestLogsReadsWithCountsAndDurations() {
+	driver := es.NewInMemoryDriver()
+	err := driver.Save([]*es.Event{
+		es.NewEvent("123", &SomethingHappened{}),
+		es.NewEvent("456", &SomethingHappened{}),
+	})
+	s.NoError(err)
+
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(driver, es.WithVerboseLogger(zerolog.New(&buffer)))
+
+	_, err = verboseDriver.Load("123")
+	s.NoError(err)
+	_, err = verboseDriver.ReadEventsOfTypes(0, 10, []string{"SomethingHappened"})
+	s.NoError(err)
+
+	logs := s.readLogs(&buffer)
+	s.Equal(2, len(logs))
+	s.Equal("debug", logs[0]["level"])
+	s.Equal("Loaded events", logs[0]["message"])
+	s.Equal("123", logs[0]["AggregateID"])
+	s.Equal(float64(1), logs[0]["Count"])
+	s.Contains(logs[0], "Duration")
+	s.Equal("debug", logs[1]["level"])
+	s.Equal("Read events", logs[1]["message"])
+	s.Equal(float64(2), logs[1]["Count"])
+	s.Equal([]interface{}{"SomethingHappened"}, logs[1]["Types"])
+	s.Contains(logs[1], "Duration")
+}
+
+func (s *VerboseDriverSuite) TestLogsFailures() {
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(
+		&BrokenDriver{ErrorMessage: "borked!"},
+		es.WithVerboseLogger(zerolog.New(&buffer)),
+	)
+
+	_, err := verboseDriver.Load("123")
+	s.Error(err)
+
+	logs := s.readLogs(&buffer)
+	s.Equal(1, len(logs))
+	s.Equal("error", logs[0]["level"])
+	s.Equal("borked!", logs[0]["error"])
+}
+
+func (s *VerboseDriverSuite) TestSamplesLogs() {
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(
+		es.NewInMemoryDriver(),
+		es.WithVerboseLogger(zerolog.New(&buffer)),
+		es.WithVerboseSampler(&zerolog.BasicSampler{N: 2}),
+	)
+
+	events := []*es.Event{}
+	for i := 0; i < 10; i++ {
+		events = append(events, es.NewEvent("123", &SomethingHappened{}))
+		events[i].AggregateVersion = int64(i)
+	}
+	err := verboseDriver.Save(events)
+	s.NoError(err)
+
+	s.Equal(5, len(s.readLogs(&buffer)))
+}
+
+func (s *VerboseDriverSuite) TestDoesNotSampleFailures() {
+	var buffer bytes.Buffer
+	verboseDriver := es.NewVerboseDriver(
+		&BrokenDriver{ErrorMessage: "borked!"},
+		es.WithVerboseLogger(zerolog.New(&buffer)),
+		es.WithVerboseSampler(&zerolog.BasicSampler{N: 2}),
+	)
+
+	for i := 0; i < 4; i++ {
+		_, err := verboseDriver.Load("123")
+		s.Error(err)
+	}
+
+	s.Equal(4, len(s.readLogs(&buffer)))
+}
+
+func (s *VerboseDriverSuite) readLogs(buffer *bytes.Buffer) []map[string]interface{} {
+	logs := []map[string]interface{}{}
+	decoder := json.NewDecoder(buffer)
+	for decoder.More() {
+		entry := map[string]interface{}{}
+		s.NoError(decoder.Decode(&entry))
+		logs = append(logs, entry)
+	}
+	return logs
+}
+
+// DebtorContacted event sample carrying personal information
+type DebtorContacted struct {
+	Name    string `es:"redact"`
+	Phone   string `json:"phone" es:"redact"`
+	Channel string
+	Attempt int
+}
+
+func (DebtorContacted) PayloadType() string {
+	return "DebtorContacted"
+}
+
+func (DebtorContacted) AggregateType() string {
+	return "SampleAggregate"
+}
+
+// DebtorsContacted event sample holding personal information in collections
+type DebtorsContacted struct {
+	ByChannel map[string]DebtorContacted
+	Any       map[string]interface{}
+	List      []*DebtorContacted
+}
+
+func (DebtorsContacted) PayloadType() string {
+	return "DebtorsContacted"
+}
+
+func (DebtorsContacted) AggregateType() string {
+	return "SampleAggregate"
+}
+
+// DebtorMarshaled event sample encoding itself, redacted fields included
+type DebtorMarshaled struct {
+	Name string `es:"redact"`
+}
+
+func (d DebtorMarshaled) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"name": d.Name})
+}
+
+func (DebtorMarshaled) PayloadType() string {
+	return "DebtorMarshaled"
+}
+
+func (DebtorMarshaled) AggregateType() string {
+	return "SampleAggregate"
+}
+
+func TestVerboseDriverConformance(t *testing.T) {
+	estest.Run(t, func(t *testing.T) (es.Driver, func()) {
+		return es.NewVerboseDriver(es.NewInMemoryDriver(), es.WithVerboseLogger(zerolog.Nop())), nil
+	})
+}